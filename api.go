@@ -0,0 +1,229 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiSink keeps the latest values of the bridged systems for the REST API (--httpListen)
+type apiSink struct {
+	sync.RWMutex
+	systems map[int]*apiSystemState
+}
+
+// apiSystemState is what the API knows about a system
+type apiSystemState struct {
+	sb        *systemBridge
+	values    map[int64]wolfsmartset.ParameterValue
+	polled    time.Time
+	available bool
+}
+
+// apiSystem is the representation of a system in /api/systems
+type apiSystem struct {
+	ID                     int        `json:"id"`
+	Name                   string     `json:"name"`
+	GatewayID              int        `json:"gatewayId"`
+	GatewaySoftwareVersion string     `json:"gatewaySoftwareVersion"`
+	Parameters             int        `json:"parameters"`
+	Available              bool       `json:"available"`
+	LastPoll               *time.Time `json:"lastPoll,omitempty"`
+}
+
+// apiValue is a value in /api/systems/{id}/values
+type apiValue struct {
+	ValueID int64  `json:"valueId"`
+	Name    string `json:"name"`
+	Menu    string `json:"menu"`
+	Tab     string `json:"tab"`
+	parameterState
+}
+
+func newAPISink() *apiSink {
+	return &apiSink{systems: map[int]*apiSystemState{}}
+}
+
+func (s *apiSink) Announce(bridges []*systemBridge) error {
+	s.Lock()
+	defer s.Unlock()
+	s.systems = map[int]*apiSystemState{}
+	for _, sb := range bridges {
+		s.systems[sb.system.ID] = &apiSystemState{sb: sb, values: map[int64]wolfsmartset.ParameterValue{}}
+	}
+	return nil
+}
+
+func (s *apiSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	state, ok := s.systems[sb.system.ID]
+	if !ok {
+		return nil
+	}
+	for _, value := range response.Values {
+		state.values[value.ValueID] = value
+	}
+	state.polled = ts
+	return nil
+}
+
+func (s *apiSink) SetAvailable(sb *systemBridge, available bool) error {
+	s.Lock()
+	defer s.Unlock()
+	if state, ok := s.systems[sb.system.ID]; ok {
+		state.available = available
+	}
+	return nil
+}
+
+func (s *apiSink) Close() error {
+	return nil
+}
+
+// handler returns the routes of the API
+func (s *apiSink) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/systems", s.getSystems)
+	mux.HandleFunc("/api/systems/", s.getSystem)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", s.getReady)
+	return mux
+}
+
+// getSystems serves GET /api/systems
+func (s *apiSink) getSystems(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	s.RLock()
+	defer s.RUnlock()
+	systems := []apiSystem{}
+	for _, state := range s.systems {
+		system := apiSystem{
+			ID:                     state.sb.system.ID,
+			Name:                   state.sb.system.Name,
+			GatewayID:              state.sb.system.GatewayID,
+			GatewaySoftwareVersion: state.sb.system.GatewaySoftwareVersion,
+			Parameters:             len(state.sb.params),
+			Available:              state.available,
+		}
+		if !state.polled.IsZero() {
+			polled := state.polled
+			system.LastPoll = &polled
+		}
+		systems = append(systems, system)
+	}
+	sort.Slice(systems, func(i, j int) bool {
+		return systems[i].ID < systems[j].ID
+	})
+	writeJSON(w, http.StatusOK, systems)
+}
+
+// getSystem serves GET /api/systems/{id}/parameters and GET /api/systems/{id}/values
+func (s *apiSink) getSystem(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/systems/"), "/")
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, "invalid system id "+parts[0])
+		return
+	}
+	s.RLock()
+	defer s.RUnlock()
+	state, ok := s.systems[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown system "+parts[0])
+		return
+	}
+
+	switch parts[1] {
+	case "parameters":
+		writeJSON(w, http.StatusOK, state.sb.params)
+	case "values":
+		values := []apiValue{}
+		for _, param := range state.sb.params {
+			value, ok := state.values[param.ValueID]
+			if !ok {
+				continue
+			}
+			values = append(values, apiValue{
+				ValueID:        param.ValueID,
+				Name:           param.Name,
+				Menu:           param.MenuItem,
+				Tab:            param.TabName,
+				parameterState: newParameterState(param.ParameterDescriptor, value, state.polled),
+			})
+		}
+		writeJSON(w, http.StatusOK, values)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// getReady serves GET /readyz, the bridge is ready when all systems are polled successfully
+func (s *apiSink) getReady(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	defer s.RUnlock()
+	if len(s.systems) == 0 {
+		writeError(w, http.StatusServiceUnavailable, "not connected to the portal")
+		return
+	}
+	for _, state := range s.systems {
+		if !state.available {
+			writeError(w, http.StatusServiceUnavailable, "system "+state.sb.system.Name+" is not available")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug("failed to write API response ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
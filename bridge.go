@@ -0,0 +1,279 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// systemBridge polls one system of the account and publishes its values
+type systemBridge struct {
+	system         wolfsmartset.System
+	config         systemConfig
+	topicRoot      string
+	pollInterval   int
+	guiDescription wolfsmartset.GuiDescription
+	params         []wolfsmartset.MenuParameter
+	valIdList      []int64
+	lastUpdate     string
+	// paramConfigs are the settings from the config file by value id
+	paramConfigs map[int64]parameterConfig
+	// topics of the parameters by value id, see buildTopics
+	topics map[int64]string
+
+	// changes suppresses unchanged values, nil if every value is published on every poll
+	changes *changeFilter
+}
+
+// newSystemBridge creates the bridge for a system. If the account has more than one system (multi),
+// topics carry the system so they don't collide, otherwise the single system layout is kept.
+func newSystemBridge(system wolfsmartset.System, multi bool) *systemBridge {
+	sb := &systemBridge{
+		system:       system,
+		config:       config.systemConfig(system),
+		topicRoot:    *mqttRootTopic,
+		pollInterval: *pollInterval,
+		lastUpdate:   "2019-12-06T18:11:40.3881067Z",
+	}
+	if *brOnlyChanges {
+		sb.changes = newChangeFilter(time.Duration(*brMaxAge) * time.Second)
+	}
+	if multi {
+		sb.topicRoot = *mqttRootTopic + "/" + slugOr(system.Name, strconv.Itoa(system.ID))
+	}
+	if len(sb.config.Topic) > 0 {
+		sb.topicRoot = sb.config.Topic
+	}
+	if sb.config.PollEvery > 0 {
+		sb.pollInterval = sb.config.PollEvery
+	}
+	return sb
+}
+
+// setup fetches the GUI description of the system and selects the parameters to poll
+func (sb *systemBridge) setup(ctx context.Context, conn *wolfConnection) error {
+	accessToken, _ := conn.get()
+	guiDescription, err := portal.GetGUIDescriptionForGateway(ctx, accessToken, sb.system.GatewayID, sb.system.ID)
+	if err != nil {
+		return err
+	}
+	sb.guiDescription = guiDescription
+	printGuiParameters(guiDescription)
+	sb.params, err = sb.config.selectParams(guiDescription.MenuParameters())
+	if err != nil {
+		return err
+	}
+
+	sb.valIdList = nil
+	sb.paramConfigs = map[int64]parameterConfig{}
+	for _, param := range sb.params {
+		sb.valIdList = append(sb.valIdList, param.ValueID)
+		pc := config.parameterConfig(sb.config, param.ParameterDescriptor)
+		sb.paramConfigs[param.ValueID] = pc
+		if sb.changes != nil {
+			sb.changes.deadbands[param.ValueID] = deadbandFor(param.ParameterDescriptor)
+			if len(pc.Deadband) > 0 {
+				rules, _ := parseDeadbands([]string{pc.Deadband}) //validated when loading the config
+				sb.changes.deadbands[param.ValueID] = &rules[0]
+			}
+		}
+	}
+
+	return sb.buildTopics()
+}
+
+// runBridge connects to the portal and polls all selected systems concurrently, the values go to sink.
+// It returns when polling one of them fails, a later call starts over with a new session.
+// When ctx is cancelled polling stops, the systems are marked offline and nil is returned.
+func runBridge(ctx context.Context, conn *wolfConnection, sink Sink) error {
+	if err := conn.tokens.ensure(ctx); err != nil {
+		return err
+	}
+	sessId, systems, backgroundRefreshTask, err := connectWolfSmartset(ctx, conn.tokens)
+	if err != nil {
+		return err
+	}
+	defer stopTask(backgroundRefreshTask)
+	conn.setSession(sessId)
+
+	bridges := make([]*systemBridge, 0, len(systems))
+	for _, system := range systems {
+		sb := newSystemBridge(system, len(systems) > 1)
+		err := sb.setup(ctx, conn)
+		if err != nil {
+			return err
+		}
+		bridges = append(bridges, sb)
+	}
+
+	if err := sink.Announce(bridges); err != nil {
+		//log and ignore, values are published anyway
+		log.Error("failed to announce parameters ", err)
+	}
+
+	failed := make(chan error, len(bridges))
+	pollCtx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, sb := range bridges {
+		wg.Add(1)
+		go func(sb *systemBridge) {
+			defer wg.Done()
+			failed <- sb.run(pollCtx, conn, sink)
+		}(sb)
+	}
+	err = <-failed
+	stop()
+	wg.Wait()
+	for _, sb := range bridges {
+		if err := sink.SetAvailable(sb, false); err != nil {
+			log.Error("failed to mark system ", sb.system.Name, " offline ", err)
+		}
+	}
+	return err
+}
+
+// run polls the system until polling fails or ctx is cancelled
+func (sb *systemBridge) run(ctx context.Context, conn *wolfConnection, sink Sink) error {
+	for {
+		accessToken, sessId := conn.get()
+		started := time.Now()
+		parameterValuesResponse, err := portal.GetParameterValues(ctx, accessToken, sessId, sb.valIdList, sb.lastUpdate, sb.system)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("system %d (%s): %w", sb.system.ID, sb.system.Name, err)
+		}
+		pollDuration.WithLabelValues(sb.system.Name).Observe(time.Since(started).Seconds())
+		lastPoll.WithLabelValues(sb.system.Name).Set(float64(time.Now().Unix()))
+		sb.lastUpdate = parameterValuesResponse.LastAccess
+		if err := sink.Publish(ctx, sb, parameterValuesResponse, time.Now()); err != nil {
+			//log and ignore, sinks retry with the next poll
+			log.Error("failed to publish values of system ", sb.system.Name, " ", err)
+		}
+		if err := sink.SetAvailable(sb, true); err != nil {
+			log.Error("failed to mark system ", sb.system.Name, " online ", err)
+		}
+
+		log.Trace("sleeping ", sb.pollInterval)
+		if !sleep(ctx, time.Duration(sb.pollInterval)*time.Second) {
+			return nil
+		}
+	}
+}
+
+func (sb *systemBridge) paramConfig(param wolfsmartset.ParameterDescriptor) parameterConfig {
+	return sb.paramConfigs[param.ValueID]
+}
+
+// paramName is the name of a parameter as published, the name in the portal unless renamed in the config
+func (sb *systemBridge) paramName(param wolfsmartset.ParameterDescriptor) string {
+	if rename := sb.paramConfig(param).Rename; len(rename) > 0 {
+		return rename
+	}
+	return param.Name
+}
+
+// paramTopic is the topic below which state and set topic of a parameter live
+func (sb *systemBridge) paramTopic(param wolfsmartset.ParameterDescriptor) string {
+	return sb.topics[param.ValueID]
+}
+
+// uniqueId identifies the home-assistant entity of a parameter, it does not depend on (localized) names
+func (sb *systemBridge) uniqueId(param wolfsmartset.ParameterDescriptor) string {
+	return fmt.Sprintf("wolf-%d-%d", sb.system.ID, param.ValueID)
+}
+
+func (sb *systemBridge) stateTopic(param wolfsmartset.ParameterDescriptor) string {
+	return sb.paramTopic(param) + "/state"
+}
+
+func (sb *systemBridge) setTopic(param wolfsmartset.ParameterDescriptor) string {
+	return sb.paramTopic(param) + "/set"
+}
+
+// jsonState tells whether the state of a parameter is published as JSON
+func (sb *systemBridge) jsonState(param wolfsmartset.ParameterDescriptor) bool {
+	if asJSON := sb.paramConfig(param).JSON; asJSON != nil {
+		return *asJSON
+	}
+	return jsonStateEnabled(param)
+}
+
+// statusTopic tells whether polling the system from the portal succeeds
+func (sb *systemBridge) statusTopic() string {
+	return sb.topicRoot + "/system/status"
+}
+
+// stateUpdate is the state of a parameter to publish
+type stateUpdate struct {
+	param   wolfsmartset.MenuParameter
+	value   wolfsmartset.ParameterValue
+	topic   string
+	payload string
+}
+
+// stateUpdates joins the polled values with the parameters and formats their state.
+// Unchanged values are skipped (see changeFilter), call published for the updates that went out.
+func (sb *systemBridge) stateUpdates(parameterValuesResponse wolfsmartset.ParameterValuesResponse, now time.Time) []stateUpdate {
+	var updates []stateUpdate
+	for _, valueStruct := range parameterValuesResponse.Values {
+		found := false
+		for _, param := range sb.params { //join with parameter meta
+			if param.ValueID == valueStruct.ValueID {
+				found = true
+				if sb.changes != nil && !sb.changes.changed(param.ParameterDescriptor, valueStruct, now) {
+					continue
+				}
+				value, err := formatState(param.ParameterDescriptor, valueStruct, now, sb.jsonState(param.ParameterDescriptor))
+				if err != nil {
+					log.Error("failed to format value of ", param.Name, " error ", err)
+					continue
+				}
+				updates = append(updates, stateUpdate{param, valueStruct, sb.stateTopic(param.ParameterDescriptor), value})
+			}
+		}
+		if found == false {
+			log.Error("valueStruct not found in parameterDescription, valueId=", valueStruct.ValueID)
+		}
+	}
+	return updates
+}
+
+// published records that an update went out, updates not recorded are published again with the next poll
+func (sb *systemBridge) published(update stateUpdate, now time.Time) {
+	if sb.changes != nil {
+		sb.changes.published(update.value, now)
+	}
+}
+
+// forEachValue calls fn for each polled value of a selected parameter
+func (sb *systemBridge) forEachValue(parameterValuesResponse wolfsmartset.ParameterValuesResponse, fn func(wolfsmartset.MenuParameter, wolfsmartset.ParameterValue)) {
+	values := map[int64]wolfsmartset.ParameterValue{}
+	for _, value := range parameterValuesResponse.Values {
+		values[value.ValueID] = value
+	}
+	for _, param := range sb.params {
+		if value, ok := values[param.ValueID]; ok {
+			fn(param, value)
+		}
+	}
+}
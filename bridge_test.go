@@ -0,0 +1,109 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSink records what the bridge passes to its sinks, cancel is called after the first poll
+type testSink struct {
+	sync.Mutex
+	cancel    context.CancelFunc
+	announced []*systemBridge
+	states    map[string]string
+	available []bool
+}
+
+func (s *testSink) Announce(bridges []*systemBridge) error {
+	s.Lock()
+	defer s.Unlock()
+	s.announced = bridges
+	return nil
+}
+
+func (s *testSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, update := range sb.stateUpdates(response, ts) {
+		s.states[update.topic] = update.payload
+		sb.published(update, ts)
+	}
+	s.cancel()
+	return nil
+}
+
+func (s *testSink) SetAvailable(sb *systemBridge, available bool) error {
+	s.Lock()
+	defer s.Unlock()
+	s.available = append(s.available, available)
+	return nil
+}
+
+func (s *testSink) Close() error {
+	return nil
+}
+
+func TestRunBridge(t *testing.T) {
+	_, server := useSimulator(t)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sink := &testSink{cancel: cancel, states: map[string]string{}}
+	conn := &wolfConnection{tokens: newTokenManager("user", "secret")}
+
+	if err := runBridge(ctx, conn, sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.announced) != 1 || len(sink.announced[0].params) != 11 {
+		t.Fatalf("announced %d systems, want 1 with 11 parameters", len(sink.announced))
+	}
+	if len(sink.states) != 11 {
+		t.Errorf("published %d states, want 11: %v", len(sink.states), sink.states)
+	}
+	for topic, want := range map[string]string{
+		"wolf/Heizkreis/1011/state":  "Automatikbetrieb",
+		"wolf/Heizkreis/1012/state":  "21.0",
+		"wolf/Warmwasser/1032/state": "50",
+	} {
+		if got := sink.states[topic]; got != want {
+			t.Errorf("%s = %q, want %q", topic, got, want)
+		}
+	}
+	if len(sink.available) != 2 || !sink.available[0] || sink.available[1] {
+		t.Errorf("availability = %v, want online after the poll and offline when stopped", sink.available)
+	}
+}
+
+func TestRunBridgeReturnsPollErrors(t *testing.T) {
+	sim, server := useSimulator(t)
+	defer server.Close()
+	sink := &testSink{cancel: func() {}, states: map[string]string{}}
+	conn := &wolfConnection{tokens: newTokenManager("user", "secret")}
+
+	sim.FailNext("GetParameterValues", http.StatusInternalServerError)
+	err := runBridge(context.Background(), conn, sink)
+	if !wolfsmartset.IsTransient(err) {
+		t.Fatalf("error = %v, want the transient error of the poll", err)
+	}
+	if len(sink.available) != 1 || sink.available[0] {
+		t.Errorf("availability = %v, want offline", sink.available)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deadbandRule suppresses changes of numeric values smaller than Value (absolute or percent of the last published value).
+// A rule without selector applies to all parameters without a rule of their own.
+type deadbandRule struct {
+	selector string
+	value    float64
+	percent  bool
+}
+
+// deadbandRules as parsed from --deadband
+var deadbandRules []deadbandRule
+
+// parseDeadbands parses entries like "0.5", "2%", "Kesseltemperatur=0.5" or "1234=2%"
+func parseDeadbands(entries []string) ([]deadbandRule, error) {
+	var rules []deadbandRule
+	for _, entry := range entries {
+		rule := deadbandRule{}
+		band := entry
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			rule.selector = strings.TrimSpace(entry[:i])
+			band = entry[i+1:]
+		}
+		band = strings.TrimSpace(band)
+		if strings.HasSuffix(band, "%") {
+			rule.percent = true
+			band = strings.TrimSuffix(band, "%")
+		}
+		value, err := strconv.ParseFloat(band, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid deadband '%s'", entry)
+		}
+		rule.value = value
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matchesParam tells whether selector (value id or name) denotes the parameter
+func matchesParam(selector string, param wolfsmartset.ParameterDescriptor) bool {
+	return selector == strconv.FormatInt(param.ValueID, 10) || strings.EqualFold(selector, param.Name) ||
+		strings.EqualFold(selector, sanitizeParamName(param.Name))
+}
+
+// deadbandFor returns the rule for a parameter, nil if there is none
+func deadbandFor(param wolfsmartset.ParameterDescriptor) *deadbandRule {
+	var fallback *deadbandRule
+	for i, rule := range deadbandRules {
+		if len(rule.selector) == 0 {
+			fallback = &deadbandRules[i]
+		} else if matchesParam(rule.selector, param) {
+			return &deadbandRules[i]
+		}
+	}
+	return fallback
+}
+
+// publishedValue is what was last published for a value
+type publishedValue struct {
+	raw   string
+	state int
+	at    time.Time
+}
+
+// changeFilter suppresses publishing of values that did not change since they were last published.
+// Values are published anyway once they are older than maxAge, so home-assistant's expire_after does not trip.
+type changeFilter struct {
+	// the sinks are called concurrently
+	sync.Mutex
+	maxAge time.Duration
+	last   map[int64]publishedValue
+	// deadbands by value id
+	deadbands map[int64]*deadbandRule
+}
+
+func newChangeFilter(maxAge time.Duration) *changeFilter {
+	return &changeFilter{maxAge: maxAge, last: map[int64]publishedValue{}, deadbands: map[int64]*deadbandRule{}}
+}
+
+// changed tells whether value needs to be published
+func (c *changeFilter) changed(param wolfsmartset.ParameterDescriptor, value wolfsmartset.ParameterValue, now time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+	last, ok := c.last[value.ValueID]
+	if !ok || last.state != value.State || now.Sub(last.at) >= c.maxAge {
+		return true
+	}
+	if last.raw == value.Value {
+		return false
+	}
+
+	rule := c.deadbands[value.ValueID]
+	if rule == nil || rule.value == 0 {
+		return true
+	}
+	oldValue, okOld := param.NumericValue(last.raw)
+	newValue, okNew := param.NumericValue(value.Value)
+	if !okOld || !okNew {
+		return true
+	}
+	band := rule.value
+	if rule.percent {
+		band = math.Abs(oldValue) * rule.value / 100
+	}
+	return math.Abs(newValue-oldValue) >= band
+}
+
+// published records value as published
+func (c *changeFilter) published(value wolfsmartset.ParameterValue, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.last[value.ValueID] = publishedValue{raw: value.Value, state: value.State, at: now}
+}
@@ -0,0 +1,87 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"testing"
+	"time"
+)
+
+func TestChangeFilterChanged(t *testing.T) {
+	temperature := wolfsmartset.ParameterDescriptor{ValueID: 1, Name: "Kesseltemperatur", Decimals: 1}
+	mode := wolfsmartset.ParameterDescriptor{ValueID: 1, Name: "Betriebsart", ListItems: []wolfsmartset.ListItem{{Value: "0"}, {Value: "1"}}}
+	absolute := []deadbandRule{{value: 0.5}}
+	percent := []deadbandRule{{selector: "Kesseltemperatur", value: 2, percent: true}}
+
+	tests := []struct {
+		name     string
+		param    wolfsmartset.ParameterDescriptor
+		deadband []deadbandRule
+		last     string // last published raw value, empty if nothing was published
+		lastAge  time.Duration
+		value    string
+		state    int
+		want     bool
+	}{
+		{"never published", temperature, nil, "", 0, "48.5", 0, true},
+		{"unchanged", temperature, nil, "48.5", time.Second, "48.5", 0, false},
+		{"changed", temperature, nil, "48.5", time.Second, "48.6", 0, true},
+		{"state changed", temperature, nil, "48.5", time.Second, "48.5", 1, true},
+		{"max age reached", temperature, nil, "48.5", time.Minute, "48.5", 0, true},
+		{"within deadband", temperature, absolute, "48.5", time.Second, "48.9", 0, false},
+		{"at deadband", temperature, absolute, "48.5", time.Second, "49.0", 0, true},
+		{"below by deadband", temperature, absolute, "48.5", time.Second, "48.0", 0, true},
+		{"within percent deadband", temperature, percent, "50", time.Second, "50.9", 0, false},
+		{"at percent deadband", temperature, percent, "50", time.Second, "51", 0, true},
+		{"deadband of another parameter", temperature, []deadbandRule{{selector: "1234", value: 5}}, "48.5", time.Second, "48.6", 0, true},
+		{"deadband ignored for options", mode, absolute, "0", time.Second, "1", 0, true},
+		{"deadband ignored for non-numbers", temperature, absolute, "48.5", time.Second, "--", 0, true},
+	}
+	defer func() { deadbandRules = nil }()
+	now := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newChangeFilter(time.Minute)
+			deadbandRules = tt.deadband
+			filter.deadbands[tt.param.ValueID] = deadbandFor(tt.param)
+			if len(tt.last) > 0 {
+				filter.published(wolfsmartset.ParameterValue{ValueID: tt.param.ValueID, Value: tt.last}, now.Add(-tt.lastAge))
+			}
+			value := wolfsmartset.ParameterValue{ValueID: tt.param.ValueID, Value: tt.value, State: tt.state}
+			if got := filter.changed(tt.param, value, now); got != tt.want {
+				t.Errorf("changed(%s -> %s) = %v, want %v", tt.last, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDeadbands(t *testing.T) {
+	rules, err := parseDeadbands([]string{"0.5", "2%", "Kesseltemperatur=0.2", "1234 = 5%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []deadbandRule{{"", 0.5, false}, {"", 2, true}, {"Kesseltemperatur", 0.2, false}, {"1234", 5, true}}
+	for i, rule := range rules {
+		if rule != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rule, want[i])
+		}
+	}
+	for _, invalid := range []string{"", "x", "-1", "a=b%"} {
+		if _, err := parseDeadbands([]string{invalid}); err == nil {
+			t.Errorf("parseDeadbands(%q) accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/matryer/runner"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// errUnknownParameter is returned when get or set are given a parameter that does not exist
+var errUnknownParameter = errors.New("unknown parameter")
+
+// errAmbiguousParameter is returned when set is given a name several parameters share
+var errAmbiguousParameter = errors.New("ambiguous parameter")
+
+// errInvalidValue is returned when set is given a value the parameter does not accept
+var errInvalidValue = errors.New("invalid value")
+
+// portalSession is the portal connection of the one-shot commands (list, get, set)
+type portalSession struct {
+	tokens    *tokenManager
+	sessId    int
+	systems   wolfsmartset.SystemList
+	tokenTask *runner.Task
+	task      *runner.Task
+	// cancel ends the waits of the tasks when closing
+	cancel context.CancelFunc
+}
+
+// openPortalSession logs in and creates a session, tokens and session are kept fresh until close is called
+func openPortalSession(ctx context.Context) (*portalSession, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	tokens := newTokenManager(*wolfUser, *wolfPw)
+	if err := tokens.ensure(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	sessId, systems, task, err := connectWolfSmartset(ctx, tokens)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	tokenTask := runner.Go(func(shouldStop runner.S) error {
+		return tokens.keepFresh(ctx, shouldStop)
+	})
+	return &portalSession{tokens: tokens, sessId: sessId, systems: systems, tokenTask: tokenTask, task: task, cancel: cancel}, nil
+}
+
+func (s *portalSession) close() {
+	s.cancel()
+	stopTask(s.task)
+	stopTask(s.tokenTask)
+}
+
+// params returns all parameters of the system as shown on the portal's GUI
+func (s *portalSession) params(ctx context.Context, system wolfsmartset.System) ([]wolfsmartset.MenuParameter, error) {
+	guiDescription, err := portal.GetGUIDescriptionForGateway(ctx, s.tokens.accessToken(), system.GatewayID, system.ID)
+	if err != nil {
+		return nil, err
+	}
+	return guiDescription.MenuParameters(), nil
+}
+
+// values fetches the current values of the parameters
+func (s *portalSession) values(ctx context.Context, system wolfsmartset.System, params []wolfsmartset.MenuParameter) ([]wolfsmartset.ParameterValue, error) {
+	var valIdList []int64
+	for _, param := range params {
+		valIdList = append(valIdList, param.ValueID)
+	}
+	values, err := portal.GetParameterValues(ctx, s.tokens.accessToken(), s.sessId, valIdList, "2019-12-06T18:11:40.3881067Z", system)
+	if err != nil {
+		return nil, err
+	}
+	return values.Values, nil
+}
+
+// systemParams are the parameters of a system picked on the command line
+type systemParams struct {
+	system wolfsmartset.System
+	params []wolfsmartset.MenuParameter
+}
+
+// find returns the parameters matching the selectors (name or value id) by system,
+// each selector has to match at least one parameter
+func (s *portalSession) find(ctx context.Context, selectors []string) ([]systemParams, error) {
+	var found []systemParams
+	matched := map[string]bool{}
+	for _, system := range s.systems {
+		params, err := s.params(ctx, system)
+		if err != nil {
+			return nil, err
+		}
+		sp := systemParams{system: system}
+		for _, selector := range selectors {
+			for _, param := range uniqueParams(params) {
+				if matchesParam(selector, param.ParameterDescriptor) {
+					sp.params = append(sp.params, param)
+					matched[selector] = true
+				}
+			}
+		}
+		if len(sp.params) > 0 {
+			found = append(found, sp)
+		}
+	}
+	for _, selector := range selectors {
+		if !matched[selector] {
+			return nil, fmt.Errorf("%w '%s', see the list command for names and value ids", errUnknownParameter, selector)
+		}
+	}
+	return found, nil
+}
+
+// getValue is a line of get --json
+type getValue struct {
+	System  string `json:"system"`
+	ValueID int64  `json:"valueId"`
+	Name    string `json:"name"`
+	parameterState
+}
+
+// runGet prints the values of the parameters given on the command line, with --watch again and again until ctx is cancelled
+func runGet(ctx context.Context) error {
+	s, err := openPortalSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	found, err := s.find(ctx, *getParams)
+	if err != nil {
+		return err
+	}
+	for {
+		for _, sp := range found {
+			values, err := s.values(ctx, sp.system, sp.params)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := printValues(os.Stdout, sp, values, len(s.systems) > 1, time.Now()); err != nil {
+				return err
+			}
+		}
+		if !*getWatch || !sleep(ctx, time.Duration(*getEvery)*time.Second) {
+			return nil
+		}
+	}
+}
+
+// printValues writes one line per parameter, 'name = value unit' or JSON with --json.
+// Names are prefixed with the system if there are several, with --watch lines start with the time.
+func printValues(w io.Writer, sp systemParams, values []wolfsmartset.ParameterValue, multi bool, now time.Time) error {
+	current := map[int64]wolfsmartset.ParameterValue{}
+	for _, value := range values {
+		current[value.ValueID] = value
+	}
+	for _, param := range sp.params {
+		value, ok := current[param.ValueID]
+		if !ok {
+			log.Warn("portal returned no value for ", param.Name)
+			continue
+		}
+		if *getJSON {
+			line, err := json.Marshal(getValue{sp.system.Name, param.ValueID, param.Name, newParameterState(param.ParameterDescriptor, value, now)})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, string(line))
+			continue
+		}
+		name := param.Name
+		if multi {
+			name = sp.system.Name + "/" + name
+		}
+		if *getWatch {
+			name = now.Format("15:04:05") + " " + name
+		}
+		fmt.Fprintln(w, strings.TrimSpace(fmt.Sprintf("%s = %s %s", name, param.DisplayValue(value.Value), param.Unit)))
+	}
+	return nil
+}
+
+// runSet validates the value given on the command line and writes it to the portal
+func runSet(ctx context.Context) error {
+	s, err := openPortalSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	found, err := s.find(ctx, []string{*setParam})
+	if err != nil {
+		return err
+	}
+	if len(found) > 1 || len(found[0].params) > 1 {
+		var matches []string
+		for _, sp := range found {
+			for _, param := range sp.params {
+				matches = append(matches, fmt.Sprintf("%s/%s/%s (%d)", sp.system.Name, param.MenuItem, param.TabName, param.ValueID))
+			}
+		}
+		return fmt.Errorf("%w '%s', use the value id or --system: %s", errAmbiguousParameter, *setParam, strings.Join(matches, ", "))
+	}
+	system, param := found[0].system, found[0].params[0]
+	value, err := param.Validate(*setValue)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidValue, err)
+	}
+	log.Info("set ", param.Name, " (", param.ValueID, ") of ", system.Name, " to ", value)
+	err = portal.WriteParameterValues(ctx, s.tokens.accessToken(), s.sessId, []wolfsmartset.WriteParameterValue{{ValueID: param.ValueID, Value: value}}, system)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSpace(fmt.Sprintf("%s = %s %s", param.Name, param.DisplayValue(value), param.Unit)))
+	return nil
+}
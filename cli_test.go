@@ -0,0 +1,111 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"testing"
+	"time"
+)
+
+func TestPrintValues(t *testing.T) {
+	sp := systemParams{
+		system: wolfsmartset.System{ID: 4711, Name: "Haus"},
+		params: []wolfsmartset.MenuParameter{
+			{ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1001, Name: "Kesseltemperatur", Unit: "°C", Decimals: 1}},
+			{ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1011, Name: "Betriebsart", ListItems: []wolfsmartset.ListItem{{Value: "2", DisplayText: "Sparbetrieb"}}}},
+			{ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1099, Name: "Ohne Wert"}},
+		},
+	}
+	values := []wolfsmartset.ParameterValue{{ValueID: 1001, Value: "48.5"}, {ValueID: 1011, Value: "2"}}
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.Local)
+	defer func() { *getJSON, *getWatch = false, false }()
+
+	tests := []struct {
+		name  string
+		json  bool
+		watch bool
+		multi bool
+		want  string
+	}{
+		{"plain", false, false, false, "Kesseltemperatur = 48.5 °C\nBetriebsart = Sparbetrieb\n"},
+		{"several systems", false, false, true, "Haus/Kesseltemperatur = 48.5 °C\nHaus/Betriebsart = Sparbetrieb\n"},
+		{"watch", false, true, false, "15:04:05 Kesseltemperatur = 48.5 °C\n15:04:05 Betriebsart = Sparbetrieb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*getJSON, *getWatch = tt.json, tt.watch
+			var out bytes.Buffer
+			if err := printValues(&out, sp, values, tt.multi, now); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+
+	*getJSON, *getWatch = true, false
+	var out bytes.Buffer
+	if err := printValues(&out, sp, values, false, now); err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(&out)
+	var lines []map[string]interface{}
+	for decoder.More() {
+		var line map[string]interface{}
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 || lines[0]["system"] != "Haus" || lines[0]["valueId"] != float64(1001) || lines[0]["value"] != 48.5 {
+		t.Errorf("JSON lines = %v", lines)
+	}
+}
+
+func TestRunSet(t *testing.T) {
+	sim, server := useSimulator(t)
+	defer server.Close()
+	defer func() { *setParam, *setValue = "", "" }()
+
+	tests := []struct {
+		param   string
+		value   string
+		valueID int64
+		want    string // value on the portal afterwards
+		wantErr error
+	}{
+		{"Raumsolltemperatur", "22,5", 1012, "22.5", nil},
+		{"1011", "sparbetrieb", 1011, "2", nil},
+		{"Raumsolltemperatur", "99", 1012, "22.5", errInvalidValue},
+		{"Kesseltemperatur", "50", 1001, "48.5", errInvalidValue},
+		{"Zimmertemperatur", "20", 0, "", errUnknownParameter},
+	}
+	for _, tt := range tests {
+		*setParam, *setValue = tt.param, tt.value
+		err := runSet(context.Background())
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("set %s %s: error = %v, want %v", tt.param, tt.value, err, tt.wantErr)
+		}
+		if got, _ := sim.Value(4711, tt.valueID); got != tt.want {
+			t.Errorf("value of %s after set = %q, want %q", tt.param, got, tt.want)
+		}
+	}
+}
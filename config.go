@@ -0,0 +1,242 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fileConfig is the content of the --config file.
+// Settings available as flag use the flag's name as key, flags and environment variables override these.
+type fileConfig struct {
+	// Parameters holds per parameter settings, the key is a parameter name or value id
+	Parameters map[string]parameterConfig `yaml:"parameters"`
+	// Systems selects systems (see --system) and holds their settings
+	Systems []systemConfig `yaml:"systems"`
+
+	// Flags are all other keys, these are applied as defaults of the flag with the same name
+	Flags map[string]interface{} `yaml:",inline"`
+}
+
+type systemConfig struct {
+	// System is the ID or name of the system
+	System    string `yaml:"system"`
+	Topic     string `yaml:"topic"`
+	PollEvery int    `yaml:"pollEvery"`
+	// Include and Exclude are rules as for --include/--exclude, Include replaces the global rules
+	Include    []string                   `yaml:"include"`
+	Exclude    []string                   `yaml:"exclude"`
+	Parameters map[string]parameterConfig `yaml:"parameters"`
+}
+
+type parameterConfig struct {
+	// Rename replaces the name of the parameter in topics and home-assistant
+	Rename string `yaml:"rename"`
+	// Topic replaces <root topic>/<name>, state and set are published below
+	Topic string `yaml:"topic"`
+	// Component overrides the home-assistant component, 'none' disables discovery for the parameter
+	Component string `yaml:"component"`
+	JSON      *bool  `yaml:"json"`
+	Deadband  string `yaml:"deadband"`
+}
+
+// config as loaded from --config, empty if there is none
+var config = &fileConfig{}
+
+// configKeyAliases maps config keys to flag names that are hard to guess
+var configKeyAliases = map[string]string{
+	"rootTopic": "rooTopic",
+}
+
+var haComponents = []string{componentSensor, componentBinarySensor, componentSelect, componentNumber, "none"}
+
+// configFileArg finds the --config argument before kingpin parses the command line,
+// values of the config file must be known before as they become flag defaults
+func configFileArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--config=") {
+			return strings.TrimPrefix(arg, "--config=")
+		}
+	}
+	return os.Getenv("WOLF_CONFIG")
+}
+
+func loadConfig(path string) (*fileConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &fileConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// flagsFor returns the flags of the application and its commands named by a config key,
+// a key like 'format' sets the flag of every command that has it
+func flagsFor(key string) []*kingpin.FlagClause {
+	if alias, ok := configKeyAliases[key]; ok {
+		key = alias
+	}
+	if key == "config" || key == "help" {
+		return nil
+	}
+	if flag := app.GetFlag(key); flag != nil {
+		return []*kingpin.FlagClause{flag}
+	}
+	var flags []*kingpin.FlagClause
+	for _, cmd := range app.Model().Commands {
+		if flag := app.GetCommand(cmd.Name).GetFlag(key); flag != nil {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
+// flagValues converts a yaml value to the string(s) kingpin parses
+func flagValues(value interface{}) []string {
+	if list, ok := value.([]interface{}); ok {
+		var values []string
+		for _, v := range list {
+			values = append(values, fmt.Sprint(v))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
+
+func (cfg *fileConfig) validate() error {
+	for key := range cfg.Flags {
+		if len(flagsFor(key)) == 0 {
+			return fmt.Errorf("unknown setting '%s'", key)
+		}
+	}
+	if err := validateParameterConfigs(cfg.Parameters); err != nil {
+		return err
+	}
+	for i, system := range cfg.Systems {
+		if len(system.System) == 0 {
+			return fmt.Errorf("systems[%d]: 'system' (ID or name) is missing", i)
+		}
+		if system.PollEvery != 0 && system.PollEvery < 10 {
+			return fmt.Errorf("system %s: pollEvery must be >=10", system.System)
+		}
+		if _, err := parseParamRules(append(append([]string{}, system.Include...), system.Exclude...)); err != nil {
+			return fmt.Errorf("system %s: %v", system.System, err)
+		}
+		if err := validateParameterConfigs(system.Parameters); err != nil {
+			return fmt.Errorf("system %s: %v", system.System, err)
+		}
+	}
+	return nil
+}
+
+func validateParameterConfigs(params map[string]parameterConfig) error {
+	for name, param := range params {
+		if len(param.Component) > 0 && !containsFold(haComponents, param.Component) {
+			return fmt.Errorf("parameter %s: unknown component '%s', use one of %v", name, param.Component, haComponents)
+		}
+		if len(param.Deadband) > 0 {
+			if _, err := parseDeadbands([]string{param.Deadband}); err != nil {
+				return fmt.Errorf("parameter %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyDefaults makes the values of the config file the defaults of the flags
+func (cfg *fileConfig) applyDefaults() {
+	for key, value := range cfg.Flags {
+		for _, flag := range flagsFor(key) {
+			flag.Default(flagValues(value)...)
+		}
+	}
+	if len(cfg.Systems) > 0 {
+		var selectors []string
+		for _, system := range cfg.Systems {
+			selectors = append(selectors, system.System)
+		}
+		app.GetFlag("system").Default(selectors...)
+	}
+}
+
+// systemConfig returns the settings for a system, the zero value if there are none
+func (cfg *fileConfig) systemConfig(system wolfsmartset.System) systemConfig {
+	for _, sc := range cfg.Systems {
+		if sc.System == strconv.Itoa(system.ID) || strings.EqualFold(sc.System, system.Name) {
+			return sc
+		}
+	}
+	return systemConfig{}
+}
+
+// parameterConfig returns the settings for a parameter, system settings take precedence over global ones.
+// A key with the value id wins over keys with the name, these are tried in sorted order.
+func (cfg *fileConfig) parameterConfig(sc systemConfig, param wolfsmartset.ParameterDescriptor) parameterConfig {
+	for _, params := range []map[string]parameterConfig{sc.Parameters, cfg.Parameters} {
+		if pc, ok := params[strconv.FormatInt(param.ValueID, 10)]; ok {
+			return pc
+		}
+		selectors := make([]string, 0, len(params))
+		for selector := range params {
+			selectors = append(selectors, selector)
+		}
+		sort.Strings(selectors)
+		for _, selector := range selectors {
+			if matchesParam(selector, param) {
+				return params[selector]
+			}
+		}
+	}
+	return parameterConfig{}
+}
+
+// includes returns the include rules, those of the system replace the global ones
+func (sc systemConfig) includes() []string {
+	if len(sc.Include) > 0 {
+		return sc.Include
+	}
+	return *paramIncludes
+}
+
+// excludes returns the global and system exclude rules
+func (sc systemConfig) excludes() []string {
+	return append(append([]string{}, *paramExcludes...), sc.Exclude...)
+}
+
+// selectParams returns the parameters of the system to use, each value id only once
+func (sc systemConfig) selectParams(params []wolfsmartset.MenuParameter) ([]wolfsmartset.MenuParameter, error) {
+	params, err := filterParams(params, sc.includes(), sc.excludes())
+	if err != nil {
+		return nil, err
+	}
+	return uniqueParams(params), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestParameterConfig(t *testing.T) {
+	var cfg fileConfig
+	err := yaml.Unmarshal([]byte(`
+parameters:
+  Raumsolltemperatur: {rename: by name}
+  raumsolltemperatur: {rename: by lower case name}
+  "1012": {rename: by value id}
+  Kesseltemperatur: {rename: boiler}
+  kesseltemperatur: {rename: lower case boiler}
+systems:
+  - system: Haus
+    parameters:
+      Kesseltemperatur: {rename: boiler of Haus}
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setpoint := wolfsmartset.ParameterDescriptor{ValueID: 1012, Name: "Raumsolltemperatur"}
+	boiler := wolfsmartset.ParameterDescriptor{ValueID: 1001, Name: "Kesseltemperatur"}
+	other := wolfsmartset.ParameterDescriptor{ValueID: 1013, Name: "Vorlauftemperatur"}
+	haus := cfg.systemConfig(wolfsmartset.System{ID: 4711, Name: "Haus"})
+	ferienhaus := cfg.systemConfig(wolfsmartset.System{ID: 4712, Name: "Ferienhaus"})
+
+	tests := []struct {
+		name   string
+		system systemConfig
+		param  wolfsmartset.ParameterDescriptor
+		want   string
+	}{
+		{"value id wins over names", ferienhaus, setpoint, "by value id"},
+		{"names in sorted order", ferienhaus, boiler, "boiler"},
+		{"system wins over global", haus, boiler, "boiler of Haus"},
+		{"global for system without own setting", haus, setpoint, "by value id"},
+		{"no setting", haus, other, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//map order is random, the result must not be
+			for i := 0; i < 20; i++ {
+				if got := cfg.parameterConfig(tt.system, tt.param).Rename; got != tt.want {
+					t.Fatalf("rename = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -7,4 +7,7 @@ const (
 	ErrWolfToken      = 4
 	ErrSysListEmpty   = 5
 	ErrGuiDescription = 6
+	ErrProtocol       = 7
+	ErrShutdown       = 8
+	ErrParameter      = 9
 )
@@ -0,0 +1,240 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/matryer/runner"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	exporterUpDesc = prometheus.NewDesc("wolf_up",
+		"Whether the last fetch of the values of a system from the portal succeeded.",
+		[]string{"system"}, nil)
+	exporterValueDesc = prometheus.NewDesc("wolf_parameter_value",
+		"Current value of a numeric parameter.",
+		[]string{"system", "menu", "tab", "name", "unit"}, nil)
+	exporterStateDesc = prometheus.NewDesc("wolf_parameter_state",
+		"Parameters with options, 1 for the current option and 0 for the others.",
+		[]string{"system", "menu", "tab", "name", "state"}, nil)
+	exporterAgeDesc = prometheus.NewDesc("wolf_values_age_seconds",
+		"Time since the values were fetched from the portal.",
+		nil, nil)
+)
+
+// exportedSystem holds the parameters of a system and their last values
+type exportedSystem struct {
+	system     wolfsmartset.System
+	params     []wolfsmartset.MenuParameter
+	valIdList  []int64
+	lastUpdate string
+	values     map[int64]wolfsmartset.ParameterValue
+	up         bool
+}
+
+// exporter is a prometheus collector fetching the values from the portal when scraped,
+// at most every minInterval. Scrapes in between are answered from the cache.
+type exporter struct {
+	sync.Mutex
+	ctx         context.Context
+	conn        *wolfConnection
+	minInterval time.Duration
+
+	sessionTask *runner.Task
+	systems     []*exportedSystem
+	fetched     time.Time
+}
+
+// runExporter serves the parameter values as prometheus metrics until ctx is cancelled
+func runExporter(ctx context.Context) error {
+	tokens := newTokenManager(*wolfUser, *wolfPw)
+	e := &exporter{
+		ctx:         ctx,
+		conn:        &wolfConnection{tokens: tokens},
+		minInterval: time.Duration(*exporterMinInterval) * time.Second,
+	}
+	//fail early on wrong credentials or an empty system list, the portal being down is retried
+	if err := supervise(ctx, "exporter", e.connect); err != nil || ctx.Err() != nil {
+		return err
+	}
+	tokenTask := runner.Go(func(shouldStop runner.S) error {
+		return tokens.keepFresh(ctx, shouldStop)
+	})
+	defer stopTask(tokenTask)
+	defer e.disconnect()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+	if err := serveMetrics(ctx, *exporterListen, prometheus.Gatherers{prometheus.DefaultGatherer, registry}); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	log.Info("exporter stopped")
+	return nil
+}
+
+// connect creates a portal session and fetches the parameters of the selected systems
+func (e *exporter) connect() error {
+	if err := e.conn.tokens.ensure(e.ctx); err != nil {
+		return err
+	}
+	sessId, systems, task, err := connectWolfSmartset(e.ctx, e.conn.tokens)
+	if err != nil {
+		return err
+	}
+	e.conn.setSession(sessId)
+	e.sessionTask = task
+
+	//the systems of the last connection are kept until this one succeeds, so they are reported down meanwhile
+	var exported []*exportedSystem
+	for _, system := range systems {
+		guiDescription, err := portal.GetGUIDescriptionForGateway(e.ctx, e.conn.tokens.accessToken(), system.GatewayID, system.ID)
+		if err != nil {
+			e.stopSession()
+			return err
+		}
+		params, err := config.systemConfig(system).selectParams(guiDescription.MenuParameters())
+		if err != nil {
+			e.stopSession()
+			return err
+		}
+		es := &exportedSystem{
+			system:     system,
+			params:     params,
+			lastUpdate: "2019-12-06T18:11:40.3881067Z",
+			values:     map[int64]wolfsmartset.ParameterValue{},
+		}
+		for _, param := range params {
+			es.valIdList = append(es.valIdList, param.ValueID)
+		}
+		exported = append(exported, es)
+	}
+	e.systems = exported
+	return nil
+}
+
+// disconnect drops the session and the parameters, the next fetch starts over
+func (e *exporter) disconnect() {
+	e.stopSession()
+	e.systems = nil
+}
+
+// fetch gets the current values of all systems, reconnecting if the last fetch failed
+func (e *exporter) fetch() {
+	if e.sessionTask == nil {
+		if err := e.connect(); err != nil {
+			log.Error("failed to connect to the portal ", err)
+			//try again after minInterval, not with every scrape
+			for _, es := range e.systems {
+				es.up = false
+			}
+			e.fetched = time.Now()
+			return
+		}
+	}
+	failed := false
+	for _, es := range e.systems {
+		accessToken, sessId := e.conn.get()
+		started := time.Now()
+		response, err := portal.GetParameterValues(e.ctx, accessToken, sessId, es.valIdList, es.lastUpdate, es.system)
+		es.up = err == nil
+		if err != nil {
+			log.Error(fmt.Errorf("system %d (%s): %w", es.system.ID, es.system.Name, err))
+			failed = true
+			continue
+		}
+		pollDuration.WithLabelValues(es.system.Name).Observe(time.Since(started).Seconds())
+		es.lastUpdate = response.LastAccess
+		for _, value := range response.Values {
+			es.values[value.ValueID] = value
+		}
+		lastPoll.WithLabelValues(es.system.Name).Set(float64(time.Now().Unix()))
+	}
+	if failed {
+		//keep the values of this fetch, but get a new session next time
+		e.stopSession()
+	}
+	e.fetched = time.Now()
+}
+
+// stopSession stops refreshing the session but keeps the cached values
+func (e *exporter) stopSession() {
+	if e.sessionTask != nil {
+		stopTask(e.sessionTask)
+		e.sessionTask = nil
+	}
+}
+
+// Describe implements prometheus.Collector
+func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- exporterUpDesc
+	ch <- exporterValueDesc
+	ch <- exporterStateDesc
+	ch <- exporterAgeDesc
+}
+
+// Collect implements prometheus.Collector, it fetches the values if the cached ones are older than minInterval
+func (e *exporter) Collect(ch chan<- prometheus.Metric) {
+	e.Lock()
+	defer e.Unlock()
+	if time.Since(e.fetched) >= e.minInterval {
+		e.fetch()
+	}
+	ch <- prometheus.MustNewConstMetric(exporterAgeDesc, prometheus.GaugeValue, time.Since(e.fetched).Seconds())
+
+	for _, es := range e.systems {
+		up := 0.0
+		if es.up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(exporterUpDesc, prometheus.GaugeValue, up, es.system.Name)
+
+		//the same name may appear twice on a tab, prometheus rejects duplicate series
+		seen := map[string]bool{}
+		emit := func(desc *prometheus.Desc, value float64, labels ...string) {
+			key := desc.String() + strings.Join(labels, "\x00")
+			if !seen[key] {
+				seen[key] = true
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+			}
+		}
+		for _, param := range es.params {
+			value, ok := es.values[param.ValueID]
+			if !ok {
+				continue
+			}
+			if len(param.ListItems) > 0 {
+				for _, item := range param.ListItems {
+					state := 0.0
+					if item.Value == value.Value {
+						state = 1
+					}
+					emit(exporterStateDesc, state, es.system.Name, param.MenuItem, param.TabName, param.Name, item.DisplayText)
+				}
+				continue
+			}
+			if v, ok := param.NumericValue(value.Value); ok {
+				emit(exporterValueDesc, v, es.system.Name, param.MenuItem, param.TabName, param.Name, param.Unit)
+			}
+		}
+	}
+}
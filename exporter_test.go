@@ -0,0 +1,55 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExporterReportsSystemsDown(t *testing.T) {
+	sim, server := useSimulator(t)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &exporter{ctx: ctx, conn: &wolfConnection{tokens: newTokenManager("user", "secret")}}
+	defer e.disconnect()
+	defer cancel()
+
+	up := func(value string) string {
+		return "# HELP wolf_up Whether the last fetch of the values of a system from the portal succeeded.\n" +
+			"# TYPE wolf_up gauge\n" +
+			"wolf_up{system=\"Simulated\"} " + value + "\n"
+	}
+	if err := testutil.CollectAndCompare(e, strings.NewReader(up("1")), "wolf_up"); err != nil {
+		t.Error(err)
+	}
+
+	//the poll fails, the reconnect gets a session but not the parameters
+	sim.FailNext("GetParameterValues", http.StatusInternalServerError)
+	if err := testutil.CollectAndCompare(e, strings.NewReader(up("0")), "wolf_up"); err != nil {
+		t.Error(err)
+	}
+	sim.FailNext("GetGuiDescriptionForGateway", http.StatusInternalServerError)
+	if err := testutil.CollectAndCompare(e, strings.NewReader(up("0")), "wolf_up"); err != nil {
+		t.Error(err)
+	}
+
+	if err := testutil.CollectAndCompare(e, strings.NewReader(up("1")), "wolf_up"); err != nil {
+		t.Error(err)
+	}
+}
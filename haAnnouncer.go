@@ -0,0 +1,177 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+// discovery keeps track of the discovery configs published by this bridge
+var discovery = &haAnnouncer{owners: map[string]map[string]string{}}
+
+// haAnnouncer publishes home-assistant discovery configs (retained) and removes the configs of
+// entities that are gone by publishing an empty retained config.
+// The topics announced are kept in a retained registry topic, so entities that disappeared while
+// the bridge was not running are removed as well.
+type haAnnouncer struct {
+	sync.Mutex
+	// owners maps e.g. a system to its announced config topics and payloads
+	owners map[string]map[string]string
+	// previous are the topics of the registry as found on start, removed by removeStale unless announced again
+	previous []string
+}
+
+// registryTopic holds the list of all config topics announced by this bridge
+func registryTopic() string {
+	return *mqttRootTopic + "/bridge/discovery"
+}
+
+// loadRegistry reads the config topics announced by an earlier run of the bridge
+func (a *haAnnouncer) loadRegistry(client MQTT.Client) {
+	received := make(chan []byte, 1)
+	token := client.Subscribe(registryTopic(), 1, func(client MQTT.Client, msg MQTT.Message) {
+		select {
+		case received <- msg.Payload():
+		default:
+		}
+	})
+	if token.Wait() && token.Error() != nil {
+		log.Error("failed to subscribe to ", registryTopic(), " error: ", token.Error())
+		return
+	}
+	defer client.Unsubscribe(registryTopic())
+
+	select {
+	case payload := <-received:
+		var topics []string
+		if err := json.Unmarshal(payload, &topics); err != nil {
+			log.Warn("ignoring invalid discovery registry ", err)
+			return
+		}
+		a.Lock()
+		a.previous = topics
+		a.Unlock()
+		log.Debug("found ", len(topics), " previously announced discovery configs")
+	case <-time.After(3 * time.Second):
+		log.Debug("no discovery registry found")
+	}
+}
+
+// announce publishes the configs of owner and removes configs it announced before but which are no longer present
+func (a *haAnnouncer) announce(client MQTT.Client, owner string, configs map[string]string) {
+	a.Lock()
+	defer a.Unlock()
+
+	for topic := range a.owners[owner] {
+		if _, ok := configs[topic]; !ok {
+			a.remove(client, topic)
+		}
+	}
+	for topic, payload := range configs {
+		if err := pubRetained(client, topic, payload); err != nil {
+			//log error and ignore
+			log.Error("failed to publish to ", topic, " error ", err)
+		}
+	}
+	a.owners[owner] = configs
+	a.saveRegistry(client)
+}
+
+// reannounce publishes all current configs again, e.g. after home-assistant restarted
+func (a *haAnnouncer) reannounce(client MQTT.Client) {
+	a.Lock()
+	defer a.Unlock()
+	log.Info("re-announcing home-assistant discovery configs")
+	for _, configs := range a.owners {
+		for topic, payload := range configs {
+			if err := pubRetained(client, topic, payload); err != nil {
+				//log error and ignore
+				log.Error("failed to publish to ", topic, " error ", err)
+			}
+		}
+	}
+}
+
+// removeStale removes configs of an earlier run that were not announced again
+func (a *haAnnouncer) removeStale(client MQTT.Client) {
+	a.Lock()
+	defer a.Unlock()
+	for _, topic := range a.previous {
+		if !a.isAnnounced(topic) {
+			a.remove(client, topic)
+		}
+	}
+	a.previous = nil
+	a.saveRegistry(client)
+}
+
+func (a *haAnnouncer) isAnnounced(topic string) bool {
+	for _, configs := range a.owners {
+		if _, ok := configs[topic]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *haAnnouncer) remove(client MQTT.Client, topic string) {
+	log.Info("removing obsolete discovery config ", topic)
+	if err := pubRetained(client, topic, ""); err != nil {
+		log.Error("failed to remove discovery config ", topic, " error ", err)
+	}
+}
+
+// saveRegistry publishes the announced topics, topics of an earlier run are kept until removeStale
+func (a *haAnnouncer) saveRegistry(client MQTT.Client) {
+	topics := append([]string{}, a.previous...)
+	for _, configs := range a.owners {
+		for topic := range configs {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	payload, err := json.Marshal(dedup(topics))
+	if err != nil {
+		log.Error("failed to marshal discovery registry ", err)
+		return
+	}
+	if err := pubRetained(client, registryTopic(), string(payload)); err != nil {
+		log.Error("failed to publish discovery registry ", err)
+	}
+}
+
+// dedup removes duplicates from a sorted slice
+func dedup(sorted []string) []string {
+	var result []string
+	for i, s := range sorted {
+		if i == 0 || sorted[i-1] != s {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// onHAStatus re-announces the discovery configs when home-assistant (re-)starts,
+// subscribe this to <discovery prefix>/status
+func onHAStatus(client MQTT.Client, msg MQTT.Message) {
+	if string(msg.Payload()) == statusOnline {
+		go discovery.reannounce(client)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// home-assistant MQTT components used for Wolf parameters
+const (
+	componentSensor       = "sensor"
+	componentBinarySensor = "binary_sensor"
+	componentSelect       = "select"
+	componentNumber       = "number"
+)
+
+type MqttDiscoveryMsg struct {
+	Name              string               `json:"name"`
+	StateTopic        string               `json:"state_topic"`
+	ValueTemplate     string               `json:"value_template,omitempty"`
+	JsonAttrTopic     string               `json:"json_attributes_topic,omitempty"`
+	CommandTopic      string               `json:"command_topic,omitempty"`
+	UnitOfMeasurement string               `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string               `json:"device_class,omitempty"`
+	StateClass        string               `json:"state_class,omitempty"`
+	Options           []string             `json:"options,omitempty"`
+	PayloadOn         string               `json:"payload_on,omitempty"`
+	PayloadOff        string               `json:"payload_off,omitempty"`
+	Min               *float64             `json:"min,omitempty"`
+	Max               *float64             `json:"max,omitempty"`
+	Step              *float64             `json:"step,omitempty"`
+	UniqueId          string               `json:"unique_id"`
+	ExpireAfter       int                  `json:"expire_after,omitempty"`
+	Qos               int                  `json:"qos"`
+	Device            *MqttDiscoveryDevice `json:"device,omitempty"`
+	Availability      []MqttAvailability   `json:"availability,omitempty"`
+	AvailabilityMode  string               `json:"availability_mode,omitempty"`
+	//SwVersion	    string `json:"sw_version"`
+}
+
+type MqttAvailability struct {
+	Topic string `json:"topic"`
+}
+
+type MqttDiscoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+	SwVersion    string   `json:"sw_version,omitempty"`
+	ViaDevice    string   `json:"via_device,omitempty"`
+}
+
+// bridgeDevice is the device representing the bridge itself, system devices are connected via this one
+func bridgeDevice() *MqttDiscoveryDevice {
+	return &MqttDiscoveryDevice{
+		Identifiers:  []string{bridgeId()},
+		Name:         "Wolf MQTT Bridge",
+		Manufacturer: "kgbvax",
+		Model:        "wolfmqttbridge",
+		SwVersion:    version,
+	}
+}
+
+// systemDevice is the device of a heating system, i.e. a gateway in the portal
+func systemDevice(system wolfsmartset.System) *MqttDiscoveryDevice {
+	return &MqttDiscoveryDevice{
+		Identifiers:  []string{fmt.Sprintf("wolf-%d", system.ID)},
+		Name:         system.Name,
+		Manufacturer: "Wolf",
+		Model:        "Smartset Gateway",
+		SerialNumber: strconv.Itoa(system.GatewayID),
+		SwVersion:    system.GatewaySoftwareVersion,
+		ViaDevice:    bridgeId(),
+	}
+}
+
+// menuDevice is a sub-device of a system for one menu item, e.g. boiler, heating circuit or DHW
+func menuDevice(system wolfsmartset.System, menuItem string) *MqttDiscoveryDevice {
+	return &MqttDiscoveryDevice{
+		Identifiers:  []string{fmt.Sprintf("wolf-%d-%s", system.ID, slugOrHash(menuItem))},
+		Name:         system.Name + " " + menuItem,
+		Manufacturer: "Wolf",
+		ViaDevice:    fmt.Sprintf("wolf-%d", system.ID),
+	}
+}
+
+// display texts of list items that represent on/off, lower case
+var onTexts = []string{"ein", "an", "on", "ja", "yes", "aktiv", "active"}
+var offTexts = []string{"aus", "off", "nein", "no", "inaktiv", "inactive"}
+
+// unitClasses maps units used by the portal to home-assistant device and state classes
+var unitClasses = map[string][2]string{
+	"°C":   {"temperature", "measurement"},
+	"°F":   {"temperature", "measurement"},
+	"bar":  {"pressure", "measurement"},
+	"mbar": {"pressure", "measurement"},
+	"hPa":  {"pressure", "measurement"},
+	"kPa":  {"pressure", "measurement"},
+	"Pa":   {"pressure", "measurement"},
+	"W":    {"power", "measurement"},
+	"kW":   {"power", "measurement"},
+	"Wh":   {"energy", "total_increasing"},
+	"kWh":  {"energy", "total_increasing"},
+	"MWh":  {"energy", "total_increasing"},
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, strings.TrimSpace(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// onOffPayloads returns the display texts for on and off if the parameter is a plain on/off switch
+func onOffPayloads(param wolfsmartset.ParameterDescriptor) (string, string, bool) {
+	if len(param.ListItems) != 2 {
+		return "", "", false
+	}
+	a, b := param.ListItems[0].DisplayText, param.ListItems[1].DisplayText
+	switch {
+	case containsFold(onTexts, a) && containsFold(offTexts, b):
+		return a, b, true
+	case containsFold(offTexts, a) && containsFold(onTexts, b):
+		return b, a, true
+	}
+	return "", "", false
+}
+
+// listOptions returns the display texts of the list items, only the selectable ones if selectableOnly
+func listOptions(param wolfsmartset.ParameterDescriptor, selectableOnly bool) []string {
+	var options []string
+	for _, item := range param.ListItems {
+		if !selectableOnly || item.IsSelectable {
+			options = append(options, item.DisplayText)
+		}
+	}
+	return options
+}
+
+// haComponent picks the home-assistant component for a parameter.
+// Writable parameters become select or number entities if set topics are enabled, everything else a
+// (binary) sensor.
+func haComponent(param wolfsmartset.ParameterDescriptor, writable bool) string {
+	if len(param.ListItems) > 0 {
+		if writable {
+			return componentSelect
+		}
+		if _, _, ok := onOffPayloads(param); ok {
+			return componentBinarySensor
+		}
+		return componentSensor
+	}
+	if writable {
+		return componentNumber
+	}
+	return componentSensor
+}
+
+// fillComponent sets the component specific fields, component is the one from haComponent unless overridden
+// by the config. Published states of list parameters are display texts, see systemBridge.publish.
+func fillComponent(disco *MqttDiscoveryMsg, param wolfsmartset.ParameterDescriptor, setTopic string, component string) {
+	writable := param.IsWritable() && !*brNoSet && len(setTopic) > 0
+	classes, known := unitClasses[param.Unit]
+
+	switch component {
+	case componentSelect:
+		if writable {
+			disco.CommandTopic = setTopic
+		}
+		disco.Options = listOptions(param, true)
+	case componentNumber:
+		if writable {
+			disco.CommandTopic = setTopic
+		}
+		disco.UnitOfMeasurement = param.Unit
+		if param.MaxValue > param.MinValue {
+			min, max := param.MinValue, param.MaxValue
+			disco.Min = &min
+			disco.Max = &max
+		}
+		if param.StepWidth > 0 {
+			step := param.StepWidth
+			disco.Step = &step
+		}
+		if known && classes[0] == "temperature" {
+			disco.DeviceClass = classes[0]
+		}
+	case componentBinarySensor:
+		disco.ExpireAfter = 120 //seconds
+		if on, off, ok := onOffPayloads(param); ok {
+			disco.PayloadOn = on
+			disco.PayloadOff = off
+		}
+	default:
+		disco.ExpireAfter = 120 //seconds
+		if len(param.ListItems) > 0 {
+			disco.DeviceClass = "enum"
+			disco.Options = listOptions(param, false)
+		} else {
+			disco.UnitOfMeasurement = param.Unit
+			if known {
+				disco.DeviceClass = classes[0]
+				disco.StateClass = classes[1]
+			} else if len(param.Unit) > 0 {
+				disco.StateClass = "measurement"
+			}
+		}
+	}
+}
+
+// registerBridgeDiscovery announces a connectivity sensor for the bridge, this creates the bridge device
+func registerBridgeDiscovery(client MQTT.Client, discoveryTopic string) {
+	newDisco := &MqttDiscoveryMsg{
+		Name:        "Wolf MQTT Bridge",
+		StateTopic:  bridgeStatusTopic(),
+		DeviceClass: "connectivity",
+		PayloadOn:   statusOnline,
+		PayloadOff:  statusOffline,
+		UniqueId:    bridgeId() + "-status",
+		Qos:         2,
+		Device:      bridgeDevice(),
+	}
+	configs := map[string]string{}
+	addDiscoveryConfig(configs, discoveryTopic+"/"+componentBinarySensor+"/"+newDisco.UniqueId+"/config", newDisco)
+	discovery.announce(client, "bridge", configs)
+}
+
+func registerHADiscovery(descriptors []wolfsmartset.MenuParameter, client MQTT.Client, discoveryTopic string, sb *systemBridge) {
+	device := systemDevice(sb.system)
+	menuDevices := map[string]*MqttDiscoveryDevice{}
+	configs := map[string]string{}
+
+	//whether polling the system works, this also creates the system device the menu devices (--haSubDevices) refer to
+	status := &MqttDiscoveryMsg{
+		Name:         "Portal connection",
+		StateTopic:   sb.statusTopic(),
+		DeviceClass:  "connectivity",
+		PayloadOn:    statusOnline,
+		PayloadOff:   statusOffline,
+		UniqueId:     fmt.Sprintf("wolf-%d-status", sb.system.ID),
+		Qos:          2,
+		Device:       device,
+		Availability: []MqttAvailability{{Topic: bridgeStatusTopic()}},
+	}
+	addDiscoveryConfig(configs, discoveryTopic+"/"+componentBinarySensor+"/"+status.UniqueId+"/config", status)
+
+	for _, param := range descriptors {
+		writable := param.IsWritable() && !*brNoSet
+		component := sb.paramConfig(param.ParameterDescriptor).Component
+		if (component == componentSelect || component == componentNumber) && !writable {
+			//home-assistant rejects these without command topic
+			log.Warn(param.Name, " is read-only (or --noSet is given), it can't be a ", component, ", using the default component")
+			component = ""
+		}
+		if component == componentSelect && len(param.ListItems) == 0 {
+			log.Warn(param.Name, " has no options, it can't be a ", component, ", using the default component")
+			component = ""
+		}
+		if len(component) == 0 {
+			component = haComponent(param.ParameterDescriptor, writable)
+		}
+		if component == "none" {
+			continue
+		}
+
+		var newDisco = &MqttDiscoveryMsg{}
+		newDisco.Name = sb.paramName(param.ParameterDescriptor)
+		newDisco.UniqueId = sb.uniqueId(param.ParameterDescriptor)
+		newDisco.StateTopic = sb.stateTopic(param.ParameterDescriptor)
+		if sb.jsonState(param.ParameterDescriptor) {
+			newDisco.ValueTemplate = "{{ value_json.value }}"
+			newDisco.JsonAttrTopic = newDisco.StateTopic
+		}
+		newDisco.Qos = 2
+		newDisco.Device = device
+		if *haSubDevices && len(param.MenuItem) > 0 {
+			if _, ok := menuDevices[param.MenuItem]; !ok {
+				menuDevices[param.MenuItem] = menuDevice(sb.system, param.MenuItem)
+			}
+			newDisco.Device = menuDevices[param.MenuItem]
+		}
+		//entities are only available if the bridge is connected and polling the system works
+		newDisco.Availability = []MqttAvailability{{Topic: bridgeStatusTopic()}, {Topic: sb.statusTopic()}}
+		newDisco.AvailabilityMode = "all"
+		//newDisco.SwVersion="1.0"
+		setTopic := ""
+		if writable {
+			setTopic = sb.setTopic(param.ParameterDescriptor)
+		}
+		fillComponent(newDisco, param.ParameterDescriptor, setTopic, component)
+		configTopic := discoveryTopic + "/" + component + "/" + newDisco.UniqueId + "/config"
+		addDiscoveryConfig(configs, configTopic, newDisco)
+	}
+	discovery.announce(client, fmt.Sprintf("system-%d", sb.system.ID), configs)
+}
+
+func addDiscoveryConfig(configs map[string]string, configTopic string, newDisco *MqttDiscoveryMsg) {
+	discoJson, err := json.Marshal(newDisco)
+	if err != nil {
+		//internal errer thus fatal
+		log.Fatal("failed to marshal config payload ", newDisco, err)
+		os.Exit(-1)
+	}
+	configs[configTopic] = string(discoJson)
+}
@@ -0,0 +1,116 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"strings"
+	"testing"
+)
+
+func TestDiscoveryComponents(t *testing.T) {
+	modes := []wolfsmartset.ListItem{{Value: "0", DisplayText: "Aus", IsSelectable: true}, {Value: "1", DisplayText: "Automatik", IsSelectable: true}}
+	param := func(valueID int64, name string, readOnly bool, items []wolfsmartset.ListItem) wolfsmartset.MenuParameter {
+		return wolfsmartset.MenuParameter{MenuItem: "Heizkreis", ParameterDescriptor: wolfsmartset.ParameterDescriptor{
+			ValueID: valueID, Name: name, IsReadOnly: readOnly, ListItems: items, MinValue: 5, MaxValue: 30, StepWidth: 0.5,
+		}}
+	}
+	sb := &systemBridge{
+		system:    wolfsmartset.System{ID: 4711, Name: "Haus"},
+		topicRoot: "wolf",
+		params: []wolfsmartset.MenuParameter{
+			param(1011, "Betriebsart", false, modes),
+			param(1012, "Raumsolltemperatur", false, nil),
+			param(1013, "Vorlauftemperatur", true, nil),
+			param(1014, "Sparfaktor", false, nil),
+			param(1015, "Pumpe", true, modes),
+		},
+		paramConfigs: map[int64]parameterConfig{
+			1011: {Component: componentSelect},
+			1012: {Component: componentNumber},
+			1013: {Component: componentNumber}, // read-only
+			1014: {Component: componentSelect}, // no options
+			1015: {Component: componentSelect}, // read-only
+		},
+	}
+	if err := sb.buildTopics(); err != nil {
+		t.Fatal(err)
+	}
+	defaultNoSet := *brNoSet
+	defer func() { *brNoSet = defaultNoSet }()
+
+	tests := []struct {
+		noSet bool
+		want  map[int64]string
+	}{
+		{false, map[int64]string{1011: componentSelect, 1012: componentNumber, 1013: "sensor", 1014: componentNumber, 1015: "sensor"}},
+		{true, map[int64]string{1011: "sensor", 1012: "sensor", 1013: "sensor", 1014: "sensor", 1015: "sensor"}},
+	}
+	for _, tt := range tests {
+		*brNoSet = tt.noSet
+		client := newFakeMQTTClient()
+		registerHADiscovery(sb.params, client, "homeassistant", sb)
+		components := map[string]string{}
+		for topic, payload := range client.published {
+			levels := strings.Split(topic, "/")
+			if len(levels) == 4 && levels[0] == "homeassistant" && len(payload) > 0 {
+				components[levels[2]] = levels[1]
+			}
+		}
+		for valueID, want := range tt.want {
+			for _, p := range sb.params {
+				if p.ValueID != valueID {
+					continue
+				}
+				if got := components[sb.uniqueId(p.ParameterDescriptor)]; got != want {
+					t.Errorf("noSet %v: %s announced as %q, want %q", tt.noSet, p.Name, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDiscoverySystemDevice(t *testing.T) {
+	sb := &systemBridge{
+		system:    wolfsmartset.System{ID: 4711, Name: "Haus"},
+		topicRoot: "wolf",
+		params: []wolfsmartset.MenuParameter{
+			{MenuItem: "Heizgerät", ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1001, Name: "Kesseltemperatur", IsReadOnly: true}},
+		},
+	}
+	if err := sb.buildTopics(); err != nil {
+		t.Fatal(err)
+	}
+	defaultSubDevices := *haSubDevices
+	defer func() { *haSubDevices = defaultSubDevices }()
+	*haSubDevices = true
+	client := newFakeMQTTClient()
+	registerHADiscovery(sb.params, client, "homeassistant", sb)
+
+	var status, boiler MqttDiscoveryMsg
+	if err := json.Unmarshal([]byte(client.published["homeassistant/binary_sensor/wolf-4711-status/config"]), &status); err != nil {
+		t.Fatal("no portal connection entity: ", err)
+	}
+	if status.StateTopic != sb.statusTopic() || status.Device == nil || status.Device.Identifiers[0] != "wolf-4711" {
+		t.Errorf("portal connection entity = %+v, want the system status on the system device", status)
+	}
+	if err := json.Unmarshal([]byte(client.published["homeassistant/sensor/"+sb.uniqueId(sb.params[0].ParameterDescriptor)+"/config"]), &boiler); err != nil {
+		t.Fatal(err)
+	}
+	if boiler.Device == nil || boiler.Device.ViaDevice != "wolf-4711" {
+		t.Errorf("parameter device = %+v, want a menu device below the system device", boiler.Device)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// influxWriteTimeout bounds a write to InfluxDB, writes are done while polling
+const influxWriteTimeout = 10 * time.Second
+
+// influxSink writes poll results as InfluxDB line protocol, either to the
+// HTTP write endpoint of InfluxDB 2 or to a file
+type influxSink struct {
+	sync.Mutex
+	// writeURL is the write endpoint including org, bucket and precision, empty when writing to out
+	writeURL string
+	token    string
+	client   *http.Client
+	out      io.WriteCloser
+}
+
+// newInfluxSink creates the sink configured by the flags, nil if none is configured
+func newInfluxSink() (*influxSink, error) {
+	switch {
+	case len(*influxURL) > 0:
+		u, err := url.Parse(strings.TrimSuffix(*influxURL, "/") + "/api/v2/write")
+		if err != nil {
+			return nil, err
+		}
+		query := url.Values{}
+		query.Set("org", *influxOrg)
+		query.Set("bucket", *influxBucket)
+		query.Set("precision", "ns")
+		u.RawQuery = query.Encode()
+		log.Info("writing values to InfluxDB at ", *influxURL, " bucket ", *influxBucket)
+		return &influxSink{writeURL: u.String(), token: *influxToken, client: &http.Client{Timeout: influxWriteTimeout}}, nil
+	case *influxFile == "-":
+		return &influxSink{out: os.Stdout}, nil
+	case len(*influxFile) > 0:
+		f, err := os.OpenFile(*influxFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("writing values as line protocol to ", *influxFile)
+		return &influxSink{out: f}, nil
+	}
+	return nil, nil
+}
+
+// write sends one batch of lines
+func (w *influxSink) write(ctx context.Context, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	batch := strings.Join(lines, "\n") + "\n"
+	if w.out != nil {
+		w.Lock()
+		defer w.Unlock()
+		_, err := io.WriteString(w.out, batch)
+		return err
+	}
+
+	req, err := http.NewRequest("POST", w.writeURL, strings.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if len(w.token) > 0 {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("InfluxDB write failed: %s %s", res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Close closes the output file, if any
+func (w *influxSink) Close() error {
+	if w.out != nil && w.out != os.Stdout {
+		return w.out.Close()
+	}
+	return nil
+}
+
+func (w *influxSink) Announce(bridges []*systemBridge) error {
+	return nil
+}
+
+// Publish writes the values of one poll of a system as one batch
+func (w *influxSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	var lines []string
+	sb.forEachValue(response, func(param wolfsmartset.MenuParameter, value wolfsmartset.ParameterValue) {
+		if line, ok := influxLine(sb.system, param, value, ts); ok {
+			lines = append(lines, line)
+		}
+	})
+	return w.write(ctx, lines)
+}
+
+func (w *influxSink) SetAvailable(sb *systemBridge, available bool) error {
+	return nil
+}
+
+// influxLine formats a value as line protocol: the measurement is menu and tab of the parameter,
+// numbers are written as field value, options as their code (value) and text (text).
+func influxLine(system wolfsmartset.System, param wolfsmartset.MenuParameter, value wolfsmartset.ParameterValue, ts time.Time) (string, bool) {
+	var fields []string
+	if len(param.ListItems) > 0 {
+		if code, err := strconv.ParseFloat(value.Value, 64); err == nil {
+			fields = append(fields, "value="+strconv.FormatFloat(code, 'f', -1, 64))
+		}
+		fields = append(fields, "text="+influxString(param.DisplayValue(value.Value)))
+	} else if v, ok := param.NumericValue(value.Value); ok {
+		fields = append(fields, "value="+strconv.FormatFloat(v, 'f', -1, 64))
+	} else {
+		return "", false
+	}
+
+	var line strings.Builder
+	line.WriteString(influxEscape(param.MenuItem+"/"+param.TabName, ", "))
+	tags := [][2]string{
+		{"gateway", strconv.Itoa(system.GatewayID)},
+		{"parameter", param.Name},
+		{"system", system.Name},
+		{"unit", param.Unit},
+		{"value_id", strconv.FormatInt(param.ValueID, 10)},
+	}
+	for _, tag := range tags { //sorted by key as recommended by InfluxDB
+		if len(tag[1]) > 0 {
+			line.WriteString("," + tag[0] + "=" + influxEscape(tag[1], ",= "))
+		}
+	}
+	line.WriteString(" " + strings.Join(fields, ",") + " " + strconv.FormatInt(ts.UnixNano(), 10))
+	return line.String(), true
+}
+
+// influxEscape escapes the characters in special with a backslash
+func influxEscape(s string, special string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// influxString quotes a string field value
+func influxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,126 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	system := wolfsmartset.System{ID: 4711, GatewayID: 1234, Name: "Mein Haus"}
+	temperature := wolfsmartset.MenuParameter{MenuItem: "Heizgerät", TabName: "Übersicht", ParameterDescriptor: wolfsmartset.ParameterDescriptor{
+		ValueID: 1001, Name: "Kesseltemperatur", Unit: "°C", Decimals: 1,
+	}}
+	mode := wolfsmartset.MenuParameter{MenuItem: "Heizkreis 1, oben", TabName: "Übersicht", ParameterDescriptor: wolfsmartset.ParameterDescriptor{
+		ValueID: 1011, Name: "Betriebsart=Modus", ListItems: []wolfsmartset.ListItem{
+			{Value: "0", DisplayText: `Aus "manuell"`},
+			{Value: "2", DisplayText: "Sparbetrieb"},
+		},
+	}}
+	ts := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name   string
+		param  wolfsmartset.MenuParameter
+		value  string
+		want   string
+		wantOk bool
+	}{
+		{"number", temperature, "48.52",
+			`Heizgerät/Übersicht,gateway=1234,parameter=Kesseltemperatur,system=Mein\ Haus,unit=°C,value_id=1001 value=48.5 1700000000000000000`, true},
+		{"decimal comma", temperature, "48,5",
+			`Heizgerät/Übersicht,gateway=1234,parameter=Kesseltemperatur,system=Mein\ Haus,unit=°C,value_id=1001 value=48.5 1700000000000000000`, true},
+		{"option", mode, "2",
+			`Heizkreis\ 1\,\ oben/Übersicht,gateway=1234,parameter=Betriebsart\=Modus,system=Mein\ Haus,value_id=1011 value=2,text="Sparbetrieb" 1700000000000000000`, true},
+		{"quoted text", mode, "0",
+			`Heizkreis\ 1\,\ oben/Übersicht,gateway=1234,parameter=Betriebsart\=Modus,system=Mein\ Haus,value_id=1011 value=0,text="Aus \"manuell\"" 1700000000000000000`, true},
+		{"not a number", temperature, "--", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := influxLine(system, tt.param, wolfsmartset.ParameterValue{ValueID: tt.param.ValueID, Value: tt.value}, ts)
+			if ok != tt.wantOk {
+				t.Fatalf("influxLine ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("influxLine =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfluxWrite(t *testing.T) {
+	var body, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+		if auth != "Token secret" {
+			http.Error(w, `{"code":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := &influxSink{writeURL: server.URL + "/api/v2/write", token: "secret", client: server.Client()}
+	if err := sink.write(context.Background(), []string{"a value=1 1", "b value=2 1"}); err != nil {
+		t.Fatal(err)
+	}
+	if body != "a value=1 1\nb value=2 1\n" {
+		t.Errorf("body = %q", body)
+	}
+	sink.token = "wrong"
+	if err := sink.write(context.Background(), []string{"a value=1 1"}); err == nil {
+		t.Error("rejected write did not fail")
+	}
+}
+
+func TestInfluxWriteTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	defer func() { *influxURL = "" }()
+
+	*influxURL = server.URL
+	sink, err := newInfluxSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.client.Timeout != influxWriteTimeout {
+		t.Fatalf("timeout = %v, want %v", sink.client.Timeout, influxWriteTimeout)
+	}
+	sink.client.Timeout = 50 * time.Millisecond
+	done := make(chan error, 1)
+	go func() {
+		done <- sink.write(context.Background(), []string{"a value=1 1"})
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("write to a hanging InfluxDB succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write to a hanging InfluxDB did not time out")
+	}
+}
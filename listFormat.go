@@ -0,0 +1,195 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// listRow is a parameter as printed by the list command
+type listRow struct {
+	System       string       `json:"system" yaml:"system"`
+	Menu         string       `json:"menu" yaml:"menu"`
+	Tab          string       `json:"tab" yaml:"tab"`
+	Group        string       `json:"group,omitempty" yaml:"group,omitempty"`
+	ValueID      int64        `json:"valueId" yaml:"valueId"`
+	ParameterID  int64        `json:"parameterId" yaml:"parameterId"`
+	Name         string       `json:"name" yaml:"name"`
+	Unit         string       `json:"unit,omitempty" yaml:"unit,omitempty"`
+	Min          *float64     `json:"min,omitempty" yaml:"min,omitempty"`
+	Max          *float64     `json:"max,omitempty" yaml:"max,omitempty"`
+	Step         *float64     `json:"step,omitempty" yaml:"step,omitempty"`
+	Decimals     int          `json:"decimals" yaml:"decimals"`
+	ReadOnly     bool         `json:"readOnly" yaml:"readOnly"`
+	Expert       bool         `json:"expert" yaml:"expert"`
+	Options      []listOption `json:"options,omitempty" yaml:"options,omitempty"`
+	Value        string       `json:"value" yaml:"value"`
+	DisplayValue string       `json:"displayValue" yaml:"displayValue"`
+}
+
+// listOption is a list item of a parameter with options
+type listOption struct {
+	Value      string `json:"value" yaml:"value"`
+	Text       string `json:"text" yaml:"text"`
+	Selectable bool   `json:"selectable" yaml:"selectable"`
+}
+
+// listFormats are the formats of the list command
+var listFormats = []string{"table", "json", "yaml", "csv", "markdown"}
+
+// newListRows joins the parameters of a system with their current values,
+// the value in the GUI description is used for parameters without a current value
+func newListRows(system wolfsmartset.System, params []wolfsmartset.MenuParameter, values []wolfsmartset.ParameterValue) []listRow {
+	current := map[int64]string{}
+	for _, value := range values {
+		current[value.ValueID] = value.Value
+	}
+	rows := make([]listRow, 0, len(params))
+	for _, param := range params {
+		value, ok := current[param.ValueID]
+		if !ok {
+			value = param.Value
+		}
+		row := listRow{
+			System:       system.Name,
+			Menu:         param.MenuItem,
+			Tab:          param.TabName,
+			Group:        param.Group,
+			ValueID:      param.ValueID,
+			ParameterID:  param.ParameterID,
+			Name:         param.Name,
+			Unit:         param.Unit,
+			Decimals:     param.Decimals,
+			ReadOnly:     !param.IsWritable(),
+			Expert:       param.IsExpertView,
+			Value:        value,
+			DisplayValue: param.DisplayValue(value),
+		}
+		if param.MaxValue > param.MinValue {
+			min, max := param.MinValue, param.MaxValue
+			row.Min, row.Max = &min, &max
+		}
+		if param.StepWidth > 0 {
+			step := param.StepWidth
+			row.Step = &step
+		}
+		for _, item := range param.ListItems {
+			row.Options = append(row.Options, listOption{item.Value, item.DisplayText, item.IsSelectable})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// writeList writes the rows to w in one of the listFormats
+func writeList(w io.Writer, format string, rows []listRow) error {
+	var columns [][]string
+	for _, row := range rows {
+		columns = append(columns, row.columns())
+	}
+	return writeOutput(w, format, rows, listHeader, columns)
+}
+
+// writeOutput writes v to w in one of the listFormats, json and yaml encode v,
+// the other formats print the columns below the header
+func writeOutput(w io.Writer, format string, v interface{}, header []string, columns [][]string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "csv":
+		out := csv.NewWriter(w)
+		out.Write(header)
+		out.WriteAll(columns)
+		return out.Error()
+	}
+
+	t := table.NewWriter()
+	t.AppendHeader(tableRow(header))
+	for _, row := range columns {
+		t.AppendRow(tableRow(row))
+	}
+	if format == "markdown" {
+		_, err := fmt.Fprintln(w, t.RenderMarkdown())
+		return err
+	}
+	t.SetStyle(table.StyleLight)
+	_, err := fmt.Fprintln(w, t.Render())
+	return err
+}
+
+func tableRow(columns []string) table.Row {
+	row := table.Row{}
+	for _, column := range columns {
+		row = append(row, column)
+	}
+	return row
+}
+
+var listHeader = []string{"System", "Menu", "Tab", "Group", "ValueID", "ParameterID", "Name", "Unit", "Min", "Max", "Step", "Decimals", "ReadOnly", "Expert", "Value", "Options"}
+
+// columns returns the row as text in the order of listHeader
+func (row listRow) columns() []string {
+	var options []string
+	for _, option := range row.Options {
+		options = append(options, option.Value+"="+option.Text)
+	}
+	value := row.Value
+	if row.DisplayValue != row.Value {
+		value += " (" + row.DisplayValue + ")"
+	}
+	return []string{
+		row.System,
+		row.Menu,
+		row.Tab,
+		row.Group,
+		strconv.FormatInt(row.ValueID, 10),
+		strconv.FormatInt(row.ParameterID, 10),
+		row.Name,
+		row.Unit,
+		formatOptionalFloat(row.Min),
+		formatOptionalFloat(row.Max),
+		formatOptionalFloat(row.Step),
+		strconv.Itoa(row.Decimals),
+		strconv.FormatBool(row.ReadOnly),
+		strconv.FormatBool(row.Expert),
+		value,
+		strings.Join(options, ", "),
+	}
+}
+
+func formatOptionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
@@ -0,0 +1,92 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"strings"
+	"testing"
+)
+
+func testListRows() []listRow {
+	system := wolfsmartset.System{ID: 4711, Name: "Haus"}
+	params := []wolfsmartset.MenuParameter{
+		{MenuItem: "Heizkreis", TabName: "Übersicht", ParameterDescriptor: wolfsmartset.ParameterDescriptor{
+			ValueID: 1011, ParameterID: 2011, Name: "Betriebsart", Value: "0", ListItems: []wolfsmartset.ListItem{
+				{Value: "0", DisplayText: "Automatikbetrieb", IsSelectable: true},
+				{Value: "2", DisplayText: "Sparbetrieb", IsSelectable: true},
+			},
+		}},
+		{MenuItem: "Heizkreis", TabName: "Übersicht", ParameterDescriptor: wolfsmartset.ParameterDescriptor{
+			ValueID: 1012, ParameterID: 2012, Name: "Raumsolltemperatur", Unit: "°C", Decimals: 1, MinValue: 5, MaxValue: 30, StepWidth: 0.5, Value: "20.0",
+		}},
+	}
+	return newListRows(system, params, []wolfsmartset.ParameterValue{{ValueID: 1011, Value: "2"}})
+}
+
+func TestWriteListJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeList(&out, "json", testListRows()); err != nil {
+		t.Fatal(err)
+	}
+	var rows []listRow
+	if err := json.Unmarshal(out.Bytes(), &rows); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if rows[0].Value != "2" || rows[0].DisplayValue != "Sparbetrieb" || len(rows[0].Options) != 2 {
+		t.Errorf("current value not used: %+v", rows[0])
+	}
+	if rows[1].Value != "20.0" || rows[1].Min == nil || *rows[1].Min != 5 || rows[1].Step == nil || *rows[1].Step != 0.5 {
+		t.Errorf("value or limits of the GUI description not used: %+v", rows[1])
+	}
+}
+
+func TestWriteListCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeList(&out, "csv", testListRows()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != strings.Join(listHeader, ",") {
+		t.Fatalf("want header and 2 rows, got %v", records)
+	}
+	if got := records[1][len(records[1])-2]; got != "2 (Sparbetrieb)" {
+		t.Errorf("value column = %q, want '2 (Sparbetrieb)'", got)
+	}
+	if got := records[1][len(records[1])-1]; got != "0=Automatikbetrieb, 2=Sparbetrieb" {
+		t.Errorf("options column = %q", got)
+	}
+}
+
+func TestWriteListTables(t *testing.T) {
+	for _, format := range []string{"table", "markdown", "yaml"} {
+		var out bytes.Buffer
+		if err := writeList(&out, format, testListRows()); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "Raumsolltemperatur") {
+			t.Errorf("%s output lacks the parameters:\n%s", format, out.String())
+		}
+	}
+}
@@ -15,43 +15,108 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 */
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/bgentry/speakeasy"
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	graylog "github.com/gemnasium/logrus-graylog-hook"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
 	"github.com/matryer/runner"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/alecthomas/kingpin.v2"
+	"math/rand"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 //import _ "github.com/motemen/go-loghttp/global"
 
+const version = "1.0"
+
 var app = kingpin.New("wolfmqttbridge", "Wolf Smartset MQTT Bridge, see github.com/kgbvax/wolfmqttbridge for documentation.")
 var debug = app.Flag("debug", "Enable debug mode. Env: DEBUG").Envar("DEBUG").Short('d').Bool()
 var trace = app.Flag("trace", "Enable trace mode. Env: TRACE").Envar("TRACE").Bool()
 var grayLogAddr = app.Flag("graylogGELFAdr", "Address of GELF logging server as 'address:port'. Env: GRAYLOG").Envar("GRAYLOG").Short('g').String()
 var wolfUser = app.Flag("user", "username at wolf-smartset.com. Env: WOLF_USER").Envar("WOLF_USER").String()
 var wolfPw = app.Flag("password", "Password for wolf-smartset.com. Env: WOLF_PW").Envar("WOLF_PW").String()
+var paramIncludes = app.Flag("include", "only use parameters matching this rule, may be repeated. Rules are a name, a value id or conditions like 'menu:Heizkreis*&tab:/^(Übersicht|Overview)$/&expert:false' on name, group, menu, tab, expert or id. Env: INCLUDE").Envar("INCLUDE").Strings()
+var paramExcludes = app.Flag("exclude", "don't use parameters matching this rule (see --include), may be repeated. Env: EXCLUDE").Envar("EXCLUDE").Strings()
+var configFile = app.Flag("config", "YAML configuration file, flags and environment variables override its settings. Env: WOLF_CONFIG").Envar("WOLF_CONFIG").String()
+var portalURL = app.Flag("portalURL", "address of the Wolf Smartset portal, e.g. of a simulated portal (see simulate). Env: WOLF_PORTAL_URL").Envar("WOLF_PORTAL_URL").Default(wolfsmartset.DefaultBaseURL).String()
+var recordDir = app.Flag("record", "store every request to the portal and its response in this directory, credentials and tokens are redacted. Env: WOLF_RECORD").Envar("WOLF_RECORD").String()
+var replayDir = app.Flag("replay", "answer requests to the portal with the responses stored with --record in this directory. Env: WOLF_REPLAY").Envar("WOLF_REPLAY").String()
+var systemSelectors = app.Flag("system", "ID or name of a system to use, may be repeated. Defaults to all systems of the account. Env: WOLF_SYSTEM").Envar("WOLF_SYSTEM").Strings()
 
 var listParamCmd = app.Command("list", "list parameters available in gateway")
+var listFormat = listParamCmd.Flag("format", "output format: table, json, yaml, csv or markdown. Env: LIST_FORMAT").Envar("LIST_FORMAT").Default("table").Enum(listFormats...)
+var systemsCmd = app.Command("systems", "list all systems of the account with gateway, software version and shares")
+var systemsFormat = systemsCmd.Flag("format", "output format: table, json, yaml, csv or markdown. Env: LIST_FORMAT").Envar("LIST_FORMAT").Default("table").Enum(listFormats...)
+var getCmd = app.Command("get", "print the current value of parameters")
+var getParams = getCmd.Arg("parameter", "name or value id of a parameter, see list").Required().Strings()
+var getWatch = getCmd.Flag("watch", "print the values again every --every seconds until interrupted").Default("false").Bool()
+var getEvery = getCmd.Flag("every", "with --watch, fetch the values every X seconds. Must be >10, defaults to 20").Default("20").Int()
+var getJSON = getCmd.Flag("json", "print a JSON object with value, raw value, unit, state and timestamp per parameter").Default("false").Bool()
+var setCmd = app.Command("set", "write the value of a parameter to the portal")
+var setParam = setCmd.Arg("parameter", "name or value id of a writable parameter, see list").Required().String()
+var setValue = setCmd.Arg("value", "new value, for parameters with options the value or the text shown on the portal").Required().String()
+var configCmd = app.Command("config", "configuration file")
+var configValidateCmd = configCmd.Command("validate", "check the configuration file given with --config")
+var simulateCmd = app.Command("simulate", "run a simulated Wolf Smartset portal for development and tests")
+var simListen = simulateCmd.Flag("simListen", "address to serve the simulated portal on, defaults to 127.0.0.1:8099. Env: SIM_LISTEN").Envar("SIM_LISTEN").Default("127.0.0.1:8099").String()
+var simFixtures = simulateCmd.Flag("fixtures", "directory with systems.json, gui_<system id>.json and optionally values_<system id>.json, defaults to a built-in system. Env: SIM_FIXTURES").Envar("SIM_FIXTURES").String()
+var simDrift = simulateCmd.Flag("drift", "maximum change of read-only numeric values per poll. Env: SIM_DRIFT").Envar("SIM_DRIFT").Default("0.5").Float64()
+var simErrorRate = simulateCmd.Flag("errorRate", "share of requests (0..1) failing with 500 Internal Server Error. Env: SIM_ERROR_RATE").Envar("SIM_ERROR_RATE").Default("0").Float64()
+var simLatency = simulateCmd.Flag("latency", "delay of every response, e.g. 2s. Env: SIM_LATENCY").Envar("SIM_LATENCY").Default("0s").Duration()
+var simTokenLifetime = simulateCmd.Flag("tokenLifetime", "lifetime of access tokens, e.g. 2m to test token refreshes. Env: SIM_TOKEN_LIFETIME").Envar("SIM_TOKEN_LIFETIME").Default("1h").Duration()
+var exporterCmd = app.Command("exporter", "serve the parameter values as prometheus metrics, without MQTT")
+var exporterListen = exporterCmd.Flag("listen", "address to serve /metrics on. Env: EXPORTER_LISTEN").Envar("EXPORTER_LISTEN").Default(":9101").String()
+var exporterMinInterval = exporterCmd.Flag("minInterval", "fetch values from the portal at most every X seconds, scrapes in between get the cached values. Must be >10, defaults to 30. Env: MIN_INTERVAL").Envar("MIN_INTERVAL").Default("30").Int()
 var brCmd = app.Command("br", "start bridge").Default()
 var mqttHost = brCmd.Flag("broker", "address of MQTT broker to connect to, e.g. tcp://mqtt.eclipse.org:1883. Env: BROKER").Envar("BROKER").String()
 var mqttUsername = brCmd.Flag("mqttUser", "username for mqtt broker. Env: BROKER_USER").Envar("BROKER_USER").String()
 var mqttPassword = brCmd.Flag("mqttPassword", "password for mqtt broker user. Env: BROKER_PW").Envar("BROKER_PW").String()
-var haDiscoveryTopic = brCmd.Flag("haDiscoTopic", "Home Assistant MQTT discovery topic, defaults to 'homeassistant'").Envar("HA_DISCO_TOPIC").Default("homeassistant").String()
-var brReadOnly = brCmd.Flag("ro", "Read-Only mode - don't write to MQTT (for testing").Default("false").Bool()
+var haDiscoveryTopic = brCmd.Flag("haDiscoTopic", "Home Assistant MQTT discovery topic, defaults to 'homeassistant'. Env: HA_DISCO_TOPIC").Envar("HA_DISCO_TOPIC").Default("homeassistant").String()
+var haSubDevices = brCmd.Flag("haSubDevices", "announce a home-assistant sub-device per menu item (e.g. boiler, heating circuit), Env: HA_SUB_DEVICES").Envar("HA_SUB_DEVICES").Default("false").Bool()
+var brReadOnly = brCmd.Flag("ro", "Read-Only mode - don't connect to MQTT, log what would be published instead (for testing)").Default("false").Bool()
+var brNoSet = brCmd.Flag("noSet", "don't subscribe to <rootTopic>/<param>/set, i.e. never write parameters to the portal. Env: NO_SET").Envar("NO_SET").Default("false").Bool()
+var brJsonState = brCmd.Flag("jsonState", "publish the state of all parameters as JSON with value, raw value, unit, state and timestamp. Env: JSON_STATE").Envar("JSON_STATE").Default("false").Bool()
+var brJsonParams = brCmd.Flag("jsonParam", "publish the state of this parameter (name or value id) as JSON, may be repeated. Env: JSON_PARAMS").Envar("JSON_PARAMS").Strings()
+var brOnlyChanges = brCmd.Flag("onlyChanges", "only publish values that changed since they were last published, use --no-onlyChanges to publish on every poll. Env: ONLY_CHANGES").Envar("ONLY_CHANGES").Default("true").Bool()
+var brDeadbands = brCmd.Flag("deadband", "ignore changes of numeric values smaller than this, absolute or in percent, for all or one parameter: '0.5', '2%', '<name or value id>=0.5'. May be repeated. Env: DEADBAND").Envar("DEADBAND").Strings()
+var brMaxAge = brCmd.Flag("maxAge", "publish unchanged values again after X seconds. Must be <120 (home-assistant's expire_after), defaults to 60. Env: MAX_AGE").Envar("MAX_AGE").Default("60").Int()
+var brTopicTemplate = brCmd.Flag("topicTemplate", "template of the topic below which state and set of a parameter are published, fields: .Root .System .SystemID .Menu .Tab .Group .Name .ParameterID .ValueID. Env: TOPIC_TEMPLATE").Envar("TOPIC_TEMPLATE").Default("{{.Root}}/{{.Menu}}/{{.ValueID}}").String()
 var mqttRootTopic = brCmd.Flag("rooTopic", "root topic, defaults to /wolf").Envar("WOLF_MQTT_ROOT_TOPIC").Default("wolf").String()
 var pollInterval = brCmd.Flag("pollEvery", "poll every X seconds. Must be >10, defaults to 20").Default("20").Envar("POLL_EVERY").Int()
+var influxURL = brCmd.Flag("influxURL", "write the values to InfluxDB 2 at this address, e.g. http://influxdb:8086. Env: INFLUX_URL").Envar("INFLUX_URL").String()
+var influxOrg = brCmd.Flag("influxOrg", "InfluxDB organization. Env: INFLUX_ORG").Envar("INFLUX_ORG").String()
+var influxBucket = brCmd.Flag("influxBucket", "InfluxDB bucket, defaults to 'wolf'. Env: INFLUX_BUCKET").Envar("INFLUX_BUCKET").Default("wolf").String()
+var influxToken = brCmd.Flag("influxToken", "InfluxDB API token. Env: INFLUX_TOKEN").Envar("INFLUX_TOKEN").String()
+var influxFile = brCmd.Flag("influxFile", "append the values as InfluxDB line protocol to this file, '-' for stdout. Env: INFLUX_FILE").Envar("INFLUX_FILE").String()
+var httpListen = brCmd.Flag("httpListen", "serve a REST API with systems, parameters and current values on this address, e.g. ':8080'. Env: HTTP_LISTEN").Envar("HTTP_LISTEN").String()
+var metricsListen = brCmd.Flag("metricsListen", "serve prometheus metrics on this address, e.g. ':9100'. Env: METRICS_LISTEN").Envar("METRICS_LISTEN").String()
+var metricsValues = brCmd.Flag("metricsValues", "also export every numeric parameter as gauge (with --metricsListen). Env: METRICS_VALUES").Envar("METRICS_VALUES").Default("false").Bool()
+
+// portal is the client used for all calls to the Wolf Smartset portal, it is created once the flags are parsed
+var portal *wolfsmartset.Client
 
 func main() {
-	kingpin.UsageTemplate(kingpin.CompactUsageTemplate).Version("1.0").Author("vax@kgbvax.net")
+	kingpin.UsageTemplate(kingpin.CompactUsageTemplate).Version(version).Author("vax@kgbvax.net")
 	kingpin.CommandLine.Help = "Wolf Smartset MQTT Bridge, see github.com/kgbvax/wolfmqttbridge for documentation."
 	kingpin.CommandLine.HelpFlag.Short('h')
+	if path := configFileArg(os.Args[1:]); len(path) > 0 {
+		cfg, err := loadConfig(path)
+		app.FatalIfError(err, "config")
+		config = cfg
+		config.applyDefaults()
+	}
 	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+	rand.Seed(time.Now().UnixNano())
 
 	if *debug == true {
 		log.SetLevel(log.DebugLevel)
@@ -63,52 +128,117 @@ func main() {
 	}
 
 	if len(*grayLogAddr) > 0 {
-		hook := graylog.NewAsyncGraylogHook(*grayLogAddr, map[string]interface{}{})
+		logHook = graylog.NewAsyncGraylogHook(*grayLogAddr, map[string]interface{}{})
 		//log.SetFormatter(&log.JSONFormatter{})
-		log.AddHook(hook)
+		log.AddHook(logHook)
 		log.Info("Logging to Graylog: ", *grayLogAddr)
-		defer hook.Flush()
+		defer flushLogs()
 
 	}
 
-	if *pollInterval < 10 {
+	if cmd == brCmd.FullCommand() && *pollInterval < 10 {
 		log.Warn("poll interval is shorter than 10sec. Setting to 10sec to prevent excessive API load")
 		*pollInterval = 10
 	}
 
+	if cmd == exporterCmd.FullCommand() && *exporterMinInterval < 10 {
+		log.Warn("minimum interval is shorter than 10sec. Setting to 10sec to prevent excessive API load")
+		*exporterMinInterval = 10
+	}
+
+	if cmd == getCmd.FullCommand() && *getEvery < 10 {
+		log.Warn("watch interval is shorter than 10sec. Setting to 10sec to prevent excessive API load")
+		*getEvery = 10
+	}
+
+	if *brMaxAge >= 120 {
+		log.Warn("max age must be shorter than expire_after (120sec). Setting to 100sec")
+		*brMaxAge = 100
+	}
+
+	var err error
+	deadbandRules, err = parseDeadbands(*brDeadbands)
+	app.FatalIfError(err, "")
+	_, err = parseParamRules(append(append([]string{}, *paramIncludes...), *paramExcludes...))
+	app.FatalIfError(err, "")
+	if cmd == brCmd.FullCommand() {
+		topicTemplate, err = parseTopicTemplate(*brTopicTemplate)
+		app.FatalIfError(err, "topicTemplate")
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	switch {
+	case len(*recordDir) > 0 && len(*replayDir) > 0:
+		app.Fatalf("--record and --replay can't be used together")
+	case len(*recordDir) > 0:
+		transport, err = newRecordingTransport(*recordDir, transport)
+		app.FatalIfError(err, "record")
+	case len(*replayDir) > 0:
+		transport, err = newReplayTransport(*replayDir)
+		app.FatalIfError(err, "replay")
+	}
+	portal = wolfsmartset.NewClient(&http.Client{Transport: instrumentedTransport{transport}})
+	app.FatalIfError(portal.SetBaseURL(*portalURL), "portalURL")
+
 	if wolfPw == nil {
 		*wolfPw = askPw()
 	}
 
-	doTheHustle(cmd)
+	doTheHustle(signalContext(), cmd)
 }
 
-func connectWolfSmartset() (AuthToken, int, System, *runner.Task) {
-	log.Debug("obtain auth token ", "user", *wolfUser)
-	aTok, err := getAuthToken(*wolfUser, *wolfPw)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(ErrWolfToken) //&bail out
-	}
+// wolfConnection is the portal connection shared between the pollers and MQTT command handlers
+type wolfConnection struct {
+	sync.RWMutex
+	tokens *tokenManager
+	sessId int
+}
+
+func (c *wolfConnection) setSession(sessId int) {
+	c.Lock()
+	defer c.Unlock()
+	c.sessId = sessId
+}
+
+// get returns the current access token and session id
+func (c *wolfConnection) get() (string, int) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.tokens.accessToken(), c.sessId
+}
+
+func (c *wolfConnection) write(ctx context.Context, values []wolfsmartset.WriteParameterValue, system wolfsmartset.System) error {
+	accessToken, sessId := c.get()
+	return portal.WriteParameterValues(ctx, accessToken, sessId, values, system)
+}
+
+// sessionRefreshInterval is how often the portal session is refreshed, the portal drops idle sessions after a few minutes
+const sessionRefreshInterval = 60 * time.Second
+
+// errNoSystems is returned when the account has no (selected) system
+var errNoSystems = errors.New("system list is empty (or no system matches --system), nothing to do")
 
+// connectWolfSmartset creates a session and returns the selected systems.
+// The returned task keeps the session alive until it is stopped or ctx is cancelled.
+func connectWolfSmartset(ctx context.Context, tokens *tokenManager) (int, wolfsmartset.SystemList, *runner.Task, error) {
 	log.Debug("create session")
-	sessId, err := createSession(aTok.AccessToken)
+	sessId, err := portal.CreateSession(ctx, tokens.accessToken())
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(ErrSession) //&bail out
+		return 0, nil, nil, err
 	}
 
 	task := runner.Go(func(shouldStop runner.S) error {
-		// do setup work
-		defer func() {
-			// do tear-down work
-		}()
-		for {
-			time.Sleep(60 * time.Second)
-
-			sessionRefresh(aTok.AccessToken, sessId)
-
-			if shouldStop() {
+		nextRefresh := time.Now().Add(sessionRefreshInterval)
+		for !shouldStop() {
+			if time.Now().After(nextRefresh) {
+				err := portal.RefreshSession(ctx, tokens.accessToken(), sessId)
+				sessionRefreshes.WithLabelValues(resultLabel(err)).Inc()
+				if err != nil && ctx.Err() == nil {
+					log.Warn("irregular session refresh ", err)
+				}
+				nextRefresh = time.Now().Add(sessionRefreshInterval)
+			}
+			if !sleep(ctx, time.Second) {
 				break
 			}
 		}
@@ -116,25 +246,43 @@ func connectWolfSmartset() (AuthToken, int, System, *runner.Task) {
 	})
 
 	log.Debug("get system list")
-	sysList, err := getSystemList(aTok.AccessToken)
+	sysList, err := portal.GetSystemList(ctx, tokens.accessToken())
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(-1) //&bail out
+		stopTask(task)
+		return 0, nil, nil, err
 	}
 
-	if len(sysList) < 1 {
-		fmt.Println("System list is empty, nothing to do.")
-		os.Exit(ErrSysListEmpty)
+	systems := selectSystems(sysList, *systemSelectors)
+	if len(systems) < 1 {
+		stopTask(task)
+		return 0, nil, nil, errNoSystems
 	}
 
-	//blindly pick the first system
-	system := sysList[0]
+	for _, system := range systems {
+		log.Info("System ID: ", system.ID)
+		log.Info("System Name: ", system.Name)
+		log.Info("Gateway ID: ", system.GatewayID)
+		log.Info("Gateway Software Version: ", system.GatewaySoftwareVersion)
+	}
+	return sessId, systems, task, nil
+}
 
-	log.Info("System ID: ", system.ID)
-	log.Info("System Name: ", system.Name)
-	log.Info("Gateway ID: ", system.GatewayID)
-	log.Info("Gateway Software Version: ", system.GatewaySoftwareVersion)
-	return aTok, sessId, system, task
+// selectSystems returns the systems matching any of the selectors (system ID or name),
+// all systems if there are no selectors
+func selectSystems(sysList wolfsmartset.SystemList, selectors []string) wolfsmartset.SystemList {
+	if len(selectors) == 0 {
+		return sysList
+	}
+	var selected wolfsmartset.SystemList
+	for _, system := range sysList {
+		for _, selector := range selectors {
+			if selector == strconv.Itoa(system.ID) || strings.EqualFold(selector, system.Name) {
+				selected = append(selected, system)
+				break
+			}
+		}
+	}
+	return selected
 }
 
 // Ask for a user's password
@@ -148,157 +296,171 @@ func askPw() string {
 	return pw
 }
 
-func doTheHustle(cmd string) {
-	var token AuthToken
-
+// doTheHustle runs the command, ctx is cancelled when the program is asked to terminate
+func doTheHustle(ctx context.Context, cmd string) {
 	log.Debug("main cmd: ", cmd)
 	switch cmd {
+	case configValidateCmd.FullCommand():
+		{
+			if len(*configFile) == 0 {
+				app.Fatalf("no configuration file, use --config or WOLF_CONFIG")
+			}
+			//the file was loaded and validated before parsing the command line
+			fmt.Println(*configFile, ": configuration OK")
+		}
+
 	case listParamCmd.FullCommand():
 		{
-			_, _, system, task := connectWolfSmartset()
-			guiDescription, _ := getGUIDescriptionForGateway(token.AccessToken, system.GatewayID, system.ID)
-			printGuiParameters(guiDescription)
-			task.Stop()
+			s, err := openPortalSession(ctx)
+			exitOnError(err)
+			var rows []listRow
+			for _, system := range s.systems {
+				params, err := s.params(ctx, system)
+				exitOnError(err)
+				params, err = config.systemConfig(system).selectParams(params)
+				exitOnError(err)
+				values, err := s.values(ctx, system, params)
+				exitOnError(err)
+				rows = append(rows, newListRows(system, params, values)...)
+			}
+			s.close()
+			exitOnError(writeList(os.Stdout, *listFormat, rows))
 		}
 
-	case brCmd.FullCommand():
+	case systemsCmd.FullCommand():
 		{
-			var needsConnection = true
+			exitOnError(runSystems(ctx))
+		}
 
-			var sessId int
-			var system System
-			var backgroundRefreshTask *runner.Task
+	case getCmd.FullCommand():
+		{
+			exitOnError(runGet(ctx))
+		}
 
+	case setCmd.FullCommand():
+		{
+			exitOnError(runSet(ctx))
+		}
+
+	case simulateCmd.FullCommand():
+		{
+			exitOnError(runSimulator(ctx))
+		}
+
+	case exporterCmd.FullCommand():
+		{
+			exitOnError(runExporter(ctx))
+		}
+
+	case brCmd.FullCommand():
+		{
 			log.Debug("start bridge")
-			lastUpdate := "2019-12-06T18:11:40.3881067Z"
-			var client MQTT.Client
+			if len(*metricsListen) > 0 {
+				app.FatalIfError(serveMetrics(ctx, *metricsListen, prometheus.DefaultGatherer), "metricsListen")
+			}
+			tokens := newTokenManager(*wolfUser, *wolfPw)
+			tokenTask := runner.Go(func(shouldStop runner.S) error {
+				return tokens.keepFresh(ctx, shouldStop)
+			})
+			conn := &wolfConnection{tokens: tokens}
+
+			var sinks fanoutSink
 			if *brReadOnly == true {
 				log.Info("Read-only mode, skip MQTT init")
+				sinks = append(sinks, newNamedSink("log", logSink{}))
 			} else {
 				log.Debug("connecting to mqtt broker at ", *mqttHost)
-				client = connectMQTT(*mqttHost, *mqttUsername, *mqttPassword)
-				defer client.Disconnect(1500)
-			}
-			var valIdList []int64
-			var params []ParameterDescriptor
-			var guiDescription GuiDescription
-			var err error
-
-			for {
-				if needsConnection {
-					if backgroundRefreshTask != nil {
-						backgroundRefreshTask.Stop()
-					}
-
-					token, sessId, system, backgroundRefreshTask = connectWolfSmartset()
-					guiDescription, err = getGUIDescriptionForGateway(token.AccessToken, system.GatewayID, system.ID)
-					printGuiParameters(guiDescription)
-					params = getPollParams(guiDescription)
-					if err != nil {
-						log.Error(err)
-						os.Exit(ErrGuiDescription)
-					}
-					if !*brReadOnly {
-						registerHADiscovery(params, client, *haDiscoveryTopic)
-					}
-					needsConnection = false
-
-					for _, param := range params {
-						valIdList = append(valIdList, param.ValueID)
-					}
+				client := connectMQTT(*mqttHost, *mqttUsername, *mqttPassword)
+				discovery.loadRegistry(client)
+				if err := subscribe(client, *haDiscoveryTopic+"/status", onHAStatus); err != nil {
+					log.Warn("home-assistant restarts won't trigger discovery ", err)
 				}
+				sinks = append(sinks, newNamedSink("mqtt", newMQTTSink(ctx, client, conn)))
+			}
+			influx, err := newInfluxSink()
+			app.FatalIfError(err, "influx")
+			if influx != nil {
+				sinks = append(sinks, newNamedSink("influx", influx))
+			}
+			if *metricsValues {
+				sinks = append(sinks, newNamedSink("metrics", metricsSink{}))
+			}
+			if len(*httpListen) > 0 {
+				api := newAPISink()
+				app.FatalIfError(serveHTTP(ctx, "REST API", *httpListen, api.handler()), "httpListen")
+				sinks = append(sinks, newNamedSink("api", api))
+			}
 
-				parameterValuesResponse, err := getParameterValues(token.AccessToken, sessId, valIdList, lastUpdate, system)
-				if err != nil {
-					log.Warn("failed to obtain parameters. attempting reconnect. Error= ", err)
-					needsConnection = true
-				} else {
-					lastUpdate = parameterValuesResponse.LastAccess
-					for _, valueStruct := range parameterValuesResponse.Values {
-						found := false
-						for _, param := range params { //join with parameter meta
-							if param.ValueID == valueStruct.ValueID {
-								found = true
-								value := valueStruct.Value
-								if len(param.ListItems) > 0 { // transform according to list item
-									for _, item := range param.ListItems {
-										if item.Value == value {
-											value = item.DisplayText
-										}
-									}
-								}
-								localTopic := makeTopic(param.Name)
-
-								//log.Debug("valueStruct response ", localTopic, "=", value)
-								if !*brReadOnly {
-									err = pub(client, localTopic, value)
-									if err != nil {
-										//log and ignore
-										log.Error("faile to publish to ", localTopic, " error ", err)
-									}
-								}
-							}
-						}
-						if found == false {
-							log.Error("valueStruct not found in parameterDescription, valueId=", valueStruct.ValueID)
-						}
-					}
-				}
-				log.Trace("sleeping ", *pollInterval)
-				time.Sleep(time.Duration(*pollInterval) * time.Second)
+			err = supervise(ctx, "bridge", func() error {
+				return runBridge(ctx, conn, sinks)
+			})
+			stopTask(tokenTask)
+			if err := sinks.Close(); err != nil {
+				log.Warn("failed to close outputs ", err)
 			}
+			exitOnError(err)
+			log.Info("bridge stopped")
 		}
 	}
 
 }
 
-func makeTopic(paramName string) string {
-	return *mqttRootTopic + "/" + sanitizeParamName(paramName) + "/state"
+// exitOnError terminates the program if err is set, the exit code tells what went wrong
+func exitOnError(err error) {
+	if err == nil {
+		return
+	}
+	log.Error(err)
+	fmt.Fprintln(os.Stderr, err.Error())
+	flushLogs()
+	switch {
+	case errors.Is(err, wolfsmartset.ErrBadCredentials):
+		os.Exit(ErrLogin)
+	case errors.Is(err, errNoSystems):
+		os.Exit(ErrSysListEmpty)
+	case errors.Is(err, wolfsmartset.ErrProtocol):
+		os.Exit(ErrProtocol)
+	case errors.Is(err, errUnknownParameter), errors.Is(err, errAmbiguousParameter), errors.Is(err, errInvalidValue):
+		os.Exit(ErrParameter)
+	default:
+		os.Exit(-1)
+	}
 }
 
 func sanitizeParamName(paramName string) string {
 	return strings.Join(strings.Fields(paramName), "_")
 }
 
-type MqttDiscoveryMsg struct {
-	Name              string `json:"name"`
-	StateTopic        string `json:"state_topic"`
-	UnitOfMeasurement string `json:"unit_of_measurement"`
-	UniqueId          string `json:"unique_id"`
-	ExpireAfter       int    `json:"expire_after"`
-	Qos               int    `json:"qos"`
-	//SwVersion	    string `json:"sw_version"`
-}
-
-func registerHADiscovery(descriptors []ParameterDescriptor, client MQTT.Client, discoveryTopic string) {
-	var wolfPrefix = "wolf-"
-	discoPrefix := "homeassistant"
-
-	for _, param := range descriptors {
-		var newDisco = &MqttDiscoveryMsg{}
-		newDisco.Name = param.Name
-		if len(param.Unit) > 0 {
-			newDisco.UnitOfMeasurement = param.Unit
+// registerSetHandlers subscribes to the set topic of every writable parameter,
+// received values are validated and forwarded to the portal
+func registerSetHandlers(ctx context.Context, descriptors []wolfsmartset.MenuParameter, client MQTT.Client, conn *wolfConnection, sb *systemBridge) {
+	for _, p := range descriptors {
+		if !p.IsWritable() {
+			continue
 		}
-		newDisco.UniqueId = wolfPrefix + param.Name
-		newDisco.StateTopic = makeTopic(param.Name)
-		newDisco.Qos = 2
-		//newDisco.SwVersion="1.0"
-		newDisco.ExpireAfter = 120 //seconds
-		configTopic := discoPrefix + "/sensor/" + newDisco.UniqueId + "/config"
-		discoJson, err := json.Marshal(newDisco)
-		if err != nil {
-			//internal errer thus fatal
-			log.Fatal("failed to marshal config payload ", newDisco, err)
-			os.Exit(-1)
-		} else {
-			if !*brReadOnly {
-				err = pub(client, configTopic, string(discoJson))
-				if err != nil {
-					//log error and ignore
-					log.Error("failed to publish to ", configTopic, " error ", err)
-				}
+		param := p
+		system := sb.system
+		setTopic := sb.setTopic(param.ParameterDescriptor)
+		err := subscribe(client, setTopic, func(client MQTT.Client, msg MQTT.Message) {
+			if msg.Retained() {
+				//delivered again on every (re)subscribe, writing it would repeat an old command
+				log.Warn("ignoring retained message on ", setTopic, ", publish set commands without retain flag")
+				return
+			}
+			value, err := param.Validate(string(msg.Payload()))
+			if err != nil {
+				log.Warn("rejected value on ", setTopic, ": ", err)
+				return
 			}
+			log.Info("setting ", param.Name, " of system ", system.Name, " to ", value)
+			err = conn.write(ctx, []wolfsmartset.WriteParameterValue{{ValueID: param.ValueID, Value: value}}, system)
+			if err != nil {
+				log.Error("failed to set ", param.Name, " error ", err)
+			}
+		})
+		if err != nil {
+			//log error and ignore
+			log.Error("failed to subscribe to ", setTopic, " error ", err)
 		}
 	}
 }
@@ -0,0 +1,49 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset/simulator"
+	log "github.com/sirupsen/logrus"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	//flags get their defaults when a command line is parsed
+	if _, err := app.Parse([]string{"br", "--ro"}); err != nil {
+		panic(err)
+	}
+	var err error
+	if topicTemplate, err = parseTopicTemplate(*brTopicTemplate); err != nil {
+		panic(err)
+	}
+	log.SetLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+// useSimulator points the portal client to a simulated portal with the default fixtures, close the server when done
+func useSimulator(t *testing.T) (*simulator.Portal, *httptest.Server) {
+	t.Helper()
+	sim, server := simulator.NewServer(simulator.DefaultFixtures(), simulator.Options{})
+	portal = wolfsmartset.NewClient(server.Client())
+	if err := portal.SetBaseURL(server.URL + "/portal/"); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return sim, server
+}
@@ -0,0 +1,117 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+var (
+	pollDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wolf_poll_duration_seconds",
+		Help:    "Time to fetch the parameter values of a system from the portal.",
+		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"system"})
+	lastPoll = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wolf_last_successful_poll_timestamp_seconds",
+		Help: "Unix time of the last successful poll of a system.",
+	}, []string{"system"})
+	portalRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wolf_portal_requests_total",
+		Help: "Requests to the portal by API call and HTTP status code, 'error' if there was no response.",
+	}, []string{"call", "code"})
+	portalLogins = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wolf_portal_logins_total",
+		Help: "Logins with username and password.",
+	})
+	tokenRefreshes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wolf_portal_token_refreshes_total",
+		Help: "Access token refreshes using the refresh token.",
+	})
+	sessionRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wolf_portal_session_refreshes_total",
+		Help: "Portal session refreshes by result (ok, error).",
+	}, []string{"result"})
+	mqttPublishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wolf_mqtt_publish_failures_total",
+		Help: "MQTT messages that could not be published.",
+	})
+	parameterValues = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wolf_parameter_value",
+		Help: "Current value of a numeric parameter, only with --metricsValues.",
+	}, []string{"system", "menu", "tab", "name", "unit"})
+)
+
+// instrumentedTransport counts the requests to the portal by API call and status code
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	portalRequests.WithLabelValues(path.Base(req.URL.Path), code).Inc()
+	return res, err
+}
+
+// resultLabel is the result label of a counter, ok or error
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// metricsSink exports the numeric parameters as gauges (--metricsValues)
+type metricsSink struct{}
+
+func (metricsSink) Announce(bridges []*systemBridge) error {
+	return nil
+}
+
+func (metricsSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	sb.forEachValue(response, func(param wolfsmartset.MenuParameter, value wolfsmartset.ParameterValue) {
+		if v, ok := param.NumericValue(value.Value); ok {
+			parameterValues.WithLabelValues(sb.system.Name, param.MenuItem, param.TabName, param.Name, param.Unit).Set(v)
+		}
+	})
+	return nil
+}
+
+func (metricsSink) SetAvailable(sb *systemBridge, available bool) error {
+	return nil
+}
+
+func (metricsSink) Close() error {
+	return nil
+}
+
+// serveMetrics serves the metrics of gatherer on addr/metrics until ctx is cancelled
+func serveMetrics(ctx context.Context, addr string, gatherer prometheus.Gatherer) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	return serveHTTP(ctx, "metrics", addr, mux)
+}
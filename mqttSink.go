@@ -0,0 +1,92 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"fmt"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"sync"
+	"time"
+)
+
+// mqttSink publishes the values to MQTT, announces the parameters to home-assistant
+// and forwards values received on the set topics to the portal
+type mqttSink struct {
+	sync.Mutex
+	ctx    context.Context
+	client MQTT.Client
+	conn   *wolfConnection
+	// available is the last published availability by system id
+	available map[int]bool
+}
+
+func newMQTTSink(ctx context.Context, client MQTT.Client, conn *wolfConnection) *mqttSink {
+	return &mqttSink{ctx: ctx, client: client, conn: conn, available: map[int]bool{}}
+}
+
+func (s *mqttSink) Announce(bridges []*systemBridge) error {
+	for _, sb := range bridges {
+		registerHADiscovery(sb.params, s.client, *haDiscoveryTopic, sb)
+		if !*brNoSet {
+			registerSetHandlers(s.ctx, sb.params, s.client, s.conn, sb)
+		}
+	}
+	registerBridgeDiscovery(s.client, *haDiscoveryTopic)
+	discovery.removeStale(s.client)
+	return nil
+}
+
+func (s *mqttSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	failed := 0
+	updates := sb.stateUpdates(response, ts)
+	for i, update := range updates {
+		if ctx.Err() != nil {
+			//the rest goes out with the next poll
+			return fmt.Errorf("gave up publishing, %d values left: %v", len(updates)-i, ctx.Err())
+		}
+		if err := pub(s.client, update.topic, update.payload); err != nil {
+			//not recording it as published makes it go out with the next poll
+			failed++
+			continue
+		}
+		sb.published(update, ts)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to publish %d values", failed)
+	}
+	return nil
+}
+
+// SetAvailable publishes the availability of the system when it changes
+func (s *mqttSink) SetAvailable(sb *systemBridge, available bool) error {
+	s.Lock()
+	defer s.Unlock()
+	if known, ok := s.available[sb.system.ID]; ok && known == available {
+		return nil
+	}
+	//on failure this is retried with the next poll
+	if err := pubRetained(s.client, sb.statusTopic(), availabilityStatus(available)); err != nil {
+		return err
+	}
+	s.available[sb.system.ID] = available
+	return nil
+}
+
+func (s *mqttSink) Close() error {
+	disconnectMQTT(s.client)
+	return nil
+}
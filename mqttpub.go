@@ -16,14 +16,35 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
 import (
 	"bytes"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"net"
 	"os"
+	"sync"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 )
 
+// payloads of the availability topics, these are home-assistant's defaults
+const (
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+// availabilityStatus is the payload of an availability topic
+func availabilityStatus(available bool) string {
+	if available {
+		return statusOnline
+	}
+	return statusOffline
+}
+
+// bridgeStatusTopic tells whether the bridge is connected to the broker, the broker publishes offline as last will
+func bridgeStatusTopic() string {
+	return *mqttRootTopic + "/bridge/status"
+}
+
 //define a function for the default message handler
 var f MQTT.MessageHandler = func(client MQTT.Client, msg MQTT.Message) {
 	log.Debug("TOPIC/MSG", msg.Topic(), "/", msg.Payload())
@@ -44,10 +65,15 @@ func getMacAddr() (addr string) {
 	return
 }
 
+// bridgeId identifies this bridge instance, it is used as MQTT client id and home-assistant device id
+func bridgeId() string {
+	return "wolfmqttbridge-" + getMacAddr()
+}
+
 func connectMQTT(host string, username string, password string) MQTT.Client {
 	opts := MQTT.NewClientOptions().AddBroker(host)
 	//when testing two clients may be running thus we grab a MAC address to create a semi-static machine specific clientID
-	clientId := "wolfmqttbridge-" + getMacAddr()
+	clientId := bridgeId()
 	log.Info("Connecting as ", clientId)
 	opts.SetClientID(clientId)
 	opts.SetDefaultPublishHandler(f)
@@ -60,6 +86,7 @@ func connectMQTT(host string, username string, password string) MQTT.Client {
 	opts.SetOrderMatters(false)
 	opts.SetOnConnectHandler(onConnect)
 	opts.SetMaxReconnectInterval(10 * time.Second)
+	opts.SetWill(bridgeStatusTopic(), statusOffline, 1, true)
 
 	//create and start a client using the above ClientOptions
 	c := MQTT.NewClient(opts)
@@ -71,18 +98,76 @@ func connectMQTT(host string, username string, password string) MQTT.Client {
 	return c
 }
 
+// subscriptions made through subscribe, these are restored whenever the client (re-)connects
+var subscriptions = map[string]MQTT.MessageHandler{}
+var subscriptionsLock sync.Mutex
+
 func onConnect(client MQTT.Client) {
 	log.Info("MQTT client connected.")
+	if err := pubRetained(client, bridgeStatusTopic(), statusOnline); err != nil {
+		log.Error("failed to announce bridge availability ", err)
+	}
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	for topic, handler := range subscriptions {
+		if token := client.Subscribe(topic, 1, handler); token.Wait() && token.Error() != nil {
+			log.Error("failed to re-subscribe to ", topic, " error: ", token.Error())
+		}
+	}
 }
 
 func onLost(client MQTT.Client, err error) {
 	log.Warn("MQTT connection lost: ", err)
 }
 
+// mqttPublishTimeout bounds the wait for the broker to acknowledge a message, paho keeps
+// messages published while the connection is down until it reconnects
+var mqttPublishTimeout = 10 * time.Second
+
 func pub(cl MQTT.Client, topic string, payload string) error {
 	log.Debug("MQTT: ", topic, " <- ", payload)
-	if token := cl.Publish(topic, 1, false, payload); token.Wait() && token.Error() != nil {
-		log.Error("failed to publish message to ", topic, " error: ", token.Error())
+	return awaitPublish(cl.Publish(topic, 1, false, payload), topic)
+}
+
+// pubRetained publishes a message the broker keeps for later subscribers
+func pubRetained(cl MQTT.Client, topic string, payload string) error {
+	log.Debug("MQTT: ", topic, " <- ", payload, " (retained)")
+	return awaitPublish(cl.Publish(topic, 1, true, payload), topic)
+}
+
+// awaitPublish waits up to mqttPublishTimeout for the broker to acknowledge the message of token
+func awaitPublish(token MQTT.Token, topic string) error {
+	var err error
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		err = fmt.Errorf("no acknowledgement from the broker within %s", mqttPublishTimeout)
+	} else {
+		err = token.Error()
+	}
+	if err != nil {
+		log.Error("failed to publish message to ", topic, " error: ", err)
+		mqttPublishFailures.Inc()
+	}
+	return err
+}
+
+// disconnectMQTT marks the bridge offline and disconnects. The broker does not send the last will
+// on a clean disconnect, so offline is published explicitly.
+func disconnectMQTT(cl MQTT.Client) {
+	token := cl.Publish(bridgeStatusTopic(), 1, true, statusOffline)
+	if !token.WaitTimeout(2*time.Second) || token.Error() != nil {
+		log.Warn("failed to publish bridge offline status ", token.Error())
+	}
+	cl.Disconnect(1000)
+	log.Info("MQTT client disconnected.")
+}
+
+func subscribe(cl MQTT.Client, topic string, handler MQTT.MessageHandler) error {
+	log.Debug("MQTT: subscribe ", topic)
+	subscriptionsLock.Lock()
+	subscriptions[topic] = handler
+	subscriptionsLock.Unlock()
+	if token := cl.Subscribe(topic, 1, handler); token.Wait() && token.Error() != nil {
+		log.Error("failed to subscribe to ", topic, " error: ", token.Error())
 		return token.Error()
 	}
 	return nil
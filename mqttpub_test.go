@@ -0,0 +1,211 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeToken is a completed MQTT token
+type fakeToken struct{}
+
+func (fakeToken) Wait() bool {
+	return true
+}
+
+func (fakeToken) WaitTimeout(time.Duration) bool {
+	return true
+}
+
+func (fakeToken) Error() error {
+	return nil
+}
+
+// pendingToken is an MQTT token the broker never acknowledges
+type pendingToken struct{}
+
+func (pendingToken) Wait() bool {
+	select {}
+}
+
+func (pendingToken) WaitTimeout(d time.Duration) bool {
+	time.Sleep(d)
+	return false
+}
+
+func (pendingToken) Error() error {
+	return nil
+}
+
+// fakeMQTTClient records subscriptions and the last message published to each topic, methods the bridge doesn't use are left to the nil embedded client
+type fakeMQTTClient struct {
+	MQTT.Client
+	sync.Mutex
+	handlers  map[string]MQTT.MessageHandler
+	published map[string]string
+}
+
+func newFakeMQTTClient() *fakeMQTTClient {
+	return &fakeMQTTClient{handlers: map[string]MQTT.MessageHandler{}, published: map[string]string{}}
+}
+
+func (c *fakeMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	c.Lock()
+	defer c.Unlock()
+	c.published[topic] = payload.(string)
+	return fakeToken{}
+}
+
+func (c *fakeMQTTClient) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	c.Lock()
+	defer c.Unlock()
+	c.handlers[topic] = callback
+	return fakeToken{}
+}
+
+// deliver passes a message to the handler subscribed to topic
+func (c *fakeMQTTClient) deliver(t *testing.T, topic string, payload string, retained bool) {
+	t.Helper()
+	c.Lock()
+	handler, ok := c.handlers[topic]
+	c.Unlock()
+	if !ok {
+		t.Fatal("not subscribed to ", topic)
+	}
+	handler(c, fakeMessage{topic: topic, payload: payload, retained: retained})
+}
+
+type fakeMessage struct {
+	topic    string
+	payload  string
+	retained bool
+}
+
+func (m fakeMessage) Duplicate() bool {
+	return false
+}
+
+func (m fakeMessage) Qos() byte {
+	return 1
+}
+
+func (m fakeMessage) Retained() bool {
+	return m.retained
+}
+
+func (m fakeMessage) Topic() string {
+	return m.topic
+}
+
+func (m fakeMessage) MessageID() uint16 {
+	return 1
+}
+
+func (m fakeMessage) Payload() []byte {
+	return []byte(m.payload)
+}
+
+func (m fakeMessage) Ack() {
+}
+
+func TestSetHandlers(t *testing.T) {
+	sim, server := useSimulator(t)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := &wolfConnection{tokens: newTokenManager("user", "secret")}
+	if err := conn.tokens.ensure(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sessId, systems, task, err := connectWolfSmartset(ctx, conn.tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cancel()
+		stopTask(task)
+	}()
+	conn.setSession(sessId)
+	sb := newSystemBridge(systems[0], false)
+	if err := sb.setup(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	client := newFakeMQTTClient()
+	registerSetHandlers(ctx, sb.params, client, conn, sb)
+
+	var setpoint, boiler wolfsmartset.MenuParameter
+	for _, param := range sb.params {
+		switch param.ValueID {
+		case 1012:
+			setpoint = param
+		case 1001:
+			boiler = param
+		}
+	}
+	if _, subscribed := client.handlers[sb.setTopic(boiler.ParameterDescriptor)]; subscribed {
+		t.Error("subscribed to the set topic of a read-only parameter")
+	}
+	setTopic := sb.setTopic(setpoint.ParameterDescriptor)
+	for _, tt := range []struct {
+		payload  string
+		retained bool
+		want     string
+	}{
+		{"22,5", false, "22.5"},
+		{"18", true, "22.5"},  // retained
+		{"99", false, "22.5"}, // out of range
+		{"19", false, "19.0"},
+	} {
+		client.deliver(t, setTopic, tt.payload, tt.retained)
+		if got, _ := sim.Value(4711, 1012); got != tt.want {
+			t.Errorf("after %q (retained %v) value = %q, want %q", tt.payload, tt.retained, got, tt.want)
+		}
+	}
+}
+
+func TestPubWithoutAcknowledgement(t *testing.T) {
+	defer func(timeout time.Duration) { mqttPublishTimeout = timeout }(mqttPublishTimeout)
+	mqttPublishTimeout = 10 * time.Millisecond
+
+	client := brokerDownClient{}
+	if err := pub(client, "wolf/1001", "42"); err == nil {
+		t.Error("unacknowledged message not reported")
+	}
+	if err := pubRetained(client, "wolf/status", statusOnline); err == nil {
+		t.Error("unacknowledged retained message not reported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sb := &systemBridge{params: []wolfsmartset.MenuParameter{{ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1001, Name: "Kesseltemperatur"}}}}
+	response := wolfsmartset.ParameterValuesResponse{Values: []wolfsmartset.ParameterValue{{ValueID: 1001, Value: "42"}}}
+	if err := newMQTTSink(ctx, client, nil).Publish(ctx, sb, response, time.Now()); err == nil {
+		t.Error("publishing with a cancelled context succeeded")
+	}
+}
+
+// brokerDownClient never gets an acknowledgement for its messages
+type brokerDownClient struct {
+	MQTT.Client
+}
+
+func (brokerDownClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	return pendingToken{}
+}
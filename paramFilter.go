@@ -0,0 +1,162 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// paramCondition tests one property of a parameter
+type paramCondition struct {
+	field   string // name, group, menu, tab, expert or id
+	pattern *regexp.Regexp
+	expert  bool
+	id      int64
+}
+
+// paramRule matches parameters that fulfill all of its conditions.
+// Rules are written as conditions joined by '&', a condition is <field>:<pattern> with field one of
+// name, group, menu, tab (pattern is a glob or a /regex/), expert (true or false) or id (a value id).
+// Without field a number is a value id and anything else a name, e.g. "menu:Heizkreis*&expert:false".
+type paramRule []paramCondition
+
+func parseParamRule(rule string) (paramRule, error) {
+	var parsed paramRule
+	for _, cond := range strings.Split(rule, "&") {
+		cond = strings.TrimSpace(cond)
+		field, pattern := "", cond
+		if i := strings.Index(cond, ":"); i > 0 {
+			field, pattern = strings.ToLower(cond[:i]), cond[i+1:]
+		}
+		switch field {
+		case "name", "group", "menu", "tab":
+		case "expert":
+			expert, err := strconv.ParseBool(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule '%s': expert must be true or false", rule)
+			}
+			parsed = append(parsed, paramCondition{field: field, expert: expert})
+			continue
+		case "id":
+			id, err := strconv.ParseInt(pattern, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule '%s': id must be a value id", rule)
+			}
+			parsed = append(parsed, paramCondition{field: field, id: id})
+			continue
+		default:
+			//no (known) field, the whole condition is a value id or a name that may contain ':'
+			if id, err := strconv.ParseInt(cond, 10, 64); err == nil {
+				parsed = append(parsed, paramCondition{field: "id", id: id})
+				continue
+			}
+			field, pattern = "name", cond
+		}
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule '%s': %v", rule, err)
+		}
+		parsed = append(parsed, paramCondition{field: field, pattern: re})
+	}
+	return parsed, nil
+}
+
+func parseParamRules(rules []string) ([]paramRule, error) {
+	var parsed []paramRule
+	for _, rule := range rules {
+		r, err := parseParamRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// compilePattern turns a /regex/ or a glob with * and ? into a case insensitive regular expression
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+	}
+	glob := regexp.QuoteMeta(pattern)
+	glob = strings.Replace(glob, `\*`, ".*", -1)
+	glob = strings.Replace(glob, `\?`, ".", -1)
+	return regexp.Compile("(?i)^" + glob + "$")
+}
+
+func (c paramCondition) matches(param wolfsmartset.MenuParameter) bool {
+	switch c.field {
+	case "id":
+		return param.ValueID == c.id
+	case "expert":
+		return param.IsExpertView == c.expert
+	case "group":
+		return c.pattern.MatchString(param.Group)
+	case "menu":
+		return c.pattern.MatchString(param.MenuItem)
+	case "tab":
+		return c.pattern.MatchString(param.TabName)
+	default:
+		return c.pattern.MatchString(param.Name) || c.pattern.MatchString(sanitizeParamName(param.Name))
+	}
+}
+
+func (r paramRule) matches(param wolfsmartset.MenuParameter) bool {
+	for _, cond := range r {
+		if !cond.matches(param) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAnyRule(rules []paramRule, param wolfsmartset.MenuParameter) bool {
+	for _, rule := range rules {
+		if rule.matches(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterParams returns the parameters matching any include rule (all if there are none) and no exclude rule
+func filterParams(params []wolfsmartset.MenuParameter, include []string, exclude []string) ([]wolfsmartset.MenuParameter, error) {
+	includeRules, err := parseParamRules(include)
+	if err != nil {
+		return nil, err
+	}
+	excludeRules, err := parseParamRules(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []wolfsmartset.MenuParameter
+	for _, param := range params {
+		if len(includeRules) > 0 && !matchesAnyRule(includeRules, param) {
+			continue
+		}
+		if matchesAnyRule(excludeRules, param) {
+			continue
+		}
+		filtered = append(filtered, param)
+	}
+	log.Debug(len(filtered), " of ", len(params), " parameters selected")
+	return filtered, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"testing"
+)
+
+func TestParseParamRule(t *testing.T) {
+	param := wolfsmartset.MenuParameter{
+		MenuItem: "Heizkreis 1",
+		TabName:  "Übersicht",
+		ParameterDescriptor: wolfsmartset.ParameterDescriptor{
+			ValueID: 1012,
+			Name:    "Raumsoll temperatur",
+			Group:   "Sollwerte",
+		},
+	}
+	expertParam := param
+	expertParam.IsExpertView = true
+
+	tests := []struct {
+		rule    string
+		param   wolfsmartset.MenuParameter
+		want    bool
+		wantErr bool
+	}{
+		{rule: "1012", param: param, want: true},
+		{rule: "1013", param: param, want: false},
+		{rule: "Raumsoll temperatur", param: param, want: true},
+		{rule: "raumsoll_temperatur", param: param, want: true},
+		{rule: "Raum*", param: param, want: true},
+		{rule: "Raum?oll*", param: param, want: true},
+		{rule: "Raum", param: param, want: false},
+		{rule: "name:/temp/", param: param, want: true},
+		{rule: "menu:Heizkreis*", param: param, want: true},
+		{rule: "menu:Heizgerät", param: param, want: false},
+		{rule: "tab:/^(Übersicht|Overview)$/", param: param, want: true},
+		{rule: "group:soll*", param: param, want: true},
+		{rule: "id:1012", param: param, want: true},
+		{rule: "menu:Heizkreis*&expert:false", param: param, want: true},
+		{rule: "menu:Heizkreis*&expert:false", param: expertParam, want: false},
+		{rule: "MENU:heizkreis* & id:1012", param: param, want: true},
+		{rule: "Zeit: Start", param: param, want: false},
+		{rule: "expert:maybe", wantErr: true},
+		{rule: "id:abc", wantErr: true},
+		{rule: "name:/(/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := parseParamRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseParamRule(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := rule.matches(tt.param); got != tt.want {
+				t.Errorf("%q matches = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterParams(t *testing.T) {
+	params := []wolfsmartset.MenuParameter{
+		{MenuItem: "Heizgerät", ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1, Name: "Kesseltemperatur"}},
+		{MenuItem: "Heizkreis", ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 2, Name: "Vorlauftemperatur"}},
+		{MenuItem: "Heizkreis", IsExpertView: true, ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 3, Name: "Heizkurve"}},
+	}
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []int64
+	}{
+		{"all", nil, nil, []int64{1, 2, 3}},
+		{"include", []string{"menu:Heizkreis"}, nil, []int64{2, 3}},
+		{"exclude", nil, []string{"expert:true"}, []int64{1, 2}},
+		{"include and exclude", []string{"*temperatur"}, []string{"1"}, []int64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered, err := filterParams(params, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, param := range filtered {
+				got = append(got, param.ValueID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got value ids %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got value ids %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
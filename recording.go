@@ -0,0 +1,286 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// redacted replaces credentials and tokens in recordings
+const redacted = "REDACTED"
+
+// sensitiveFields are form fields and JSON keys that are redacted in recordings
+var sensitiveFields = []string{"username", "password", "refresh_token", "access_token", "GatewayUsername"}
+
+// exchange is a request to the portal and its response as stored by --record
+type exchange struct {
+	Request  recordedMessage `json:"request"`
+	Response recordedMessage `json:"response"`
+}
+
+// recordedMessage holds a request or response, the body as JSON if it is valid JSON and as Text otherwise
+type recordedMessage struct {
+	Method     string          `json:"method,omitempty"`
+	URL        string          `json:"url,omitempty"`
+	StatusCode int             `json:"statusCode,omitempty"`
+	Header     http.Header     `json:"header"`
+	JSON       json.RawMessage `json:"json,omitempty"`
+	Text       string          `json:"text,omitempty"`
+}
+
+func (m *recordedMessage) setBody(body []byte) {
+	if json.Valid(body) {
+		m.JSON = body
+	} else {
+		m.Text = string(body)
+	}
+}
+
+func (m recordedMessage) body() []byte {
+	if len(m.JSON) > 0 {
+		return m.JSON
+	}
+	return []byte(m.Text)
+}
+
+// recordingTransport stores every request and response in dir, one file per exchange, with credentials redacted
+type recordingTransport struct {
+	sync.Mutex
+	dir  string
+	next http.RoundTripper
+	seq  int
+}
+
+func newRecordingTransport(dir string, next http.RoundTripper) (*recordingTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	log.Info("recording portal traffic to ", dir)
+	return &recordingTransport{dir: dir, next: next}, nil
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	ex := exchange{
+		Request:  recordedMessage{Method: req.Method, URL: req.URL.String(), Header: redactHeader(req.Header)},
+		Response: recordedMessage{StatusCode: res.StatusCode, Header: redactHeader(res.Header)},
+	}
+	ex.Request.setBody(redactBody(reqBody))
+	ex.Response.setBody(redactBody(resBody))
+	if err := t.save(path.Base(req.URL.Path), ex); err != nil {
+		//log and ignore, recording must not break the bridge
+		log.Error("failed to record ", req.URL.Path, " ", err)
+	}
+	return res, nil
+}
+
+func (t *recordingTransport) save(call string, ex exchange) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(ex); err != nil {
+		return err
+	}
+	t.Lock()
+	t.seq++
+	name := fmt.Sprintf("%05d-%s.json", t.seq, call)
+	t.Unlock()
+	return ioutil.WriteFile(filepath.Join(t.dir, name), data.Bytes(), 0644)
+}
+
+func redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, key := range []string{"Authorization", "Cookie", "Set-Cookie"} {
+		if len(header.Get(key)) > 0 {
+			header.Set(key, redacted)
+		}
+	}
+	return header
+}
+
+// redactBody replaces sensitive fields of form and JSON bodies
+func redactBody(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err == nil {
+		if !redactJSON(v) {
+			return body //keep it as is
+		}
+		if redactedBody, err := json.Marshal(v); err == nil {
+			return redactedBody
+		}
+		return body
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil && len(form) > 0 {
+		found := false
+		for _, field := range sensitiveFields {
+			if _, ok := form[field]; ok {
+				form.Set(field, redacted)
+				found = true
+			}
+		}
+		if found { //anything else, e.g. a text response, is kept as is
+			return []byte(form.Encode())
+		}
+	}
+	return body
+}
+
+// redactJSON replaces sensitive fields of a decoded JSON value, it returns whether there were any
+func redactJSON(v interface{}) bool {
+	found := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if containsFold(sensitiveFields, key) {
+				v[key] = redacted
+				found = true
+			} else if redactJSON(value) {
+				found = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if redactJSON(value) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// replayTransport answers requests with the responses recorded by --record. Requests are matched by API call,
+// query and system, each match returns the next recorded response and the last one once all were replayed.
+type replayTransport struct {
+	sync.Mutex
+	exchanges map[string][]exchange
+}
+
+func newReplayTransport(dir string) (*replayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	t := &replayTransport{exchanges: map[string][]exchange{}}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var ex exchange
+		if err := json.Unmarshal(data, &ex); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		u, err := url.Parse(ex.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		key := replayKey(u, ex.Request.body())
+		t.exchanges[key] = append(t.exchanges[key], ex)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recordings found in %s", dir)
+	}
+	log.Info("replaying ", len(files), " recorded portal requests from ", dir)
+	return t, nil
+}
+
+// replayKey identifies matching requests: the API call, its query and the system the body refers to
+func replayKey(u *url.URL, body []byte) string {
+	key := path.Base(u.Path) + "?" + u.RawQuery
+	var system struct {
+		SystemID *int `json:"SystemId"`
+	}
+	if json.Unmarshal(body, &system) == nil && system.SystemID != nil {
+		key += "#" + strconv.Itoa(*system.SystemID)
+	}
+	return key
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	key := replayKey(req.URL, body)
+
+	t.Lock()
+	recorded := t.exchanges[key]
+	if len(recorded) > 1 {
+		t.exchanges[key] = recorded[1:]
+	}
+	t.Unlock()
+
+	res := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Request:    req,
+	}
+	if len(recorded) == 0 {
+		log.Warn("no recorded response for ", key)
+		res.StatusCode = http.StatusNotFound
+		res.Header = http.Header{}
+		res.Body = ioutil.NopCloser(strings.NewReader("not recorded"))
+	} else {
+		res.StatusCode = recorded[0].Response.StatusCode
+		res.Header = recorded[0].Response.Header
+		res.Body = ioutil.NopCloser(bytes.NewReader(recorded[0].Response.body()))
+	}
+	res.Status = fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	return res, nil
+}
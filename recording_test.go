@@ -0,0 +1,128 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset/simulator"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", ""},
+		{"login form",
+			"grant_type=password&username=me%40example.com&password=secret&scope=all",
+			"grant_type=password&password=REDACTED&scope=all&username=REDACTED"},
+		{"refresh form",
+			"grant_type=refresh_token&refresh_token=abc&scope=all",
+			"grant_type=refresh_token&refresh_token=REDACTED&scope=all"},
+		{"token response",
+			`{"access_token":"a","expires_in":3600,"refresh_token":"r","CultureInfoCode":"de-DE"}`,
+			`{"CultureInfoCode":"de-DE","access_token":"REDACTED","expires_in":3600,"refresh_token":"REDACTED"}`},
+		{"system list",
+			`[{"Id":4711,"GatewayUsername":"me@example.com","Name":"Haus"}]`,
+			`[{"GatewayUsername":"REDACTED","Id":4711,"Name":"Haus"}]`},
+		{"numbers keep their precision",
+			`{"password":"x","big":12345678901234567890,"f":1.50}`,
+			`{"big":12345678901234567890,"f":1.50,"password":"REDACTED"}`},
+		{"JSON without credentials is kept as is",
+			`{"Values": [ {"ValueId": 1, "Value": "48.5"} ]}`,
+			`{"Values": [ {"ValueId": 1, "Value": "48.5"} ]}`},
+		{"form without credentials is kept as is", "b=2&a=1", "b=2&a=1"},
+		{"text is kept as is", "4711", "4711"},
+		{"html is kept as is", "<html>maintenance</html>", "<html>maintenance</html>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(redactBody([]byte(tt.body))); got != tt.want {
+				t.Errorf("redactBody(%s) =\n%s\nwant\n%s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	_, server := simulator.NewServer(simulator.DefaultFixtures(), simulator.Options{})
+	recorder, err := newRecordingTransport(dir, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := wolfsmartset.NewClient(&http.Client{Transport: recorder})
+	if err := client.SetBaseURL(server.URL + "/portal/"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := client.GetAuthToken(ctx, "me@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetSystemList(ctx, token.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("recorded %d files, want 2", len(files))
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"me@example.com", "secret", "simulator", token.AccessToken, token.RefreshToken} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains %q", filepath.Base(file), secret)
+			}
+		}
+	}
+
+	replay, err := newReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = wolfsmartset.NewClient(&http.Client{Transport: replay})
+	if err := client.SetBaseURL(server.URL + "/portal/"); err != nil {
+		t.Fatal(err)
+	}
+	systems, err := client.GetSystemList(ctx, "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(systems) != 1 || systems[0].ID != 4711 {
+		t.Errorf("replayed systems = %+v", systems)
+	}
+	if _, err := client.CreateSession(ctx, "any"); !errors.Is(err, wolfsmartset.ErrProtocol) {
+		t.Errorf("call that was not recorded: error = %v, want 404", err)
+	}
+}
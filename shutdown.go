@@ -0,0 +1,78 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	graylog "github.com/gemnasium/logrus-graylog-hook"
+	"github.com/matryer/runner"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout bounds the time for a clean shutdown, docker kills the container 10 seconds after SIGTERM
+const shutdownTimeout = 8 * time.Second
+
+// logHook is the graylog hook if logging to graylog is enabled
+var logHook *graylog.GraylogHook
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM.
+// The program exits if shutting down takes longer than shutdownTimeout or another signal arrives.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Info("received ", sig, ", shutting down")
+		cancel()
+		select {
+		case sig = <-signals:
+			log.Warn("received ", sig, " again, exiting")
+		case <-time.After(shutdownTimeout):
+			log.Error("shutdown did not finish within ", shutdownTimeout, ", exiting")
+		}
+		os.Exit(ErrShutdown)
+	}()
+	return ctx
+}
+
+// sleep waits for d or until ctx is cancelled, it returns false if ctx was cancelled
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// stopTask stops a task started with runner.Go and waits until it returned
+func stopTask(task *runner.Task) {
+	task.Stop()
+	<-task.StopChan()
+}
+
+// flushLogs sends buffered log entries, call this before exiting
+func flushLogs() {
+	if logHook != nil {
+		logHook.Flush()
+	}
+}
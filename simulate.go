@@ -0,0 +1,47 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset/simulator"
+	log "github.com/sirupsen/logrus"
+)
+
+// runSimulator serves a simulated portal until ctx is cancelled
+func runSimulator(ctx context.Context) error {
+	fixtures := simulator.DefaultFixtures()
+	if len(*simFixtures) > 0 {
+		var err error
+		fixtures, err = simulator.LoadFixtures(*simFixtures)
+		if err != nil {
+			return err
+		}
+	}
+	sim := simulator.New(fixtures, simulator.Options{
+		Username:      *wolfUser,
+		Password:      *wolfPw,
+		TokenLifetime: *simTokenLifetime,
+		Drift:         *simDrift,
+		ErrorRate:     *simErrorRate,
+		Latency:       *simLatency,
+	})
+	if err := serveHTTP(ctx, "simulated portal", *simListen, sim); err != nil {
+		return err
+	}
+	log.Info("simulating ", len(fixtures.Systems), " systems, use --portalURL http://", *simListen, "/portal/")
+	<-ctx.Done()
+	return nil
+}
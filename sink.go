@@ -0,0 +1,159 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives the parameters and polled values of the bridged systems
+type Sink interface {
+	// Announce is called with all systems once their parameters are known, and again after reconnecting to the portal
+	Announce(bridges []*systemBridge) error
+	// Publish is called with the values of every poll of a system
+	Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error
+	// SetAvailable tells whether polling a system works
+	SetAvailable(sb *systemBridge, available bool) error
+	// Close is called when the bridge stops
+	Close() error
+}
+
+// namedSink is a sink with a name for error messages
+type namedSink struct {
+	name string
+	Sink
+	// busy is 1 while a call of the sink is running
+	busy int32
+}
+
+func newNamedSink(name string, sink Sink) *namedSink {
+	return &namedSink{name: name, Sink: sink}
+}
+
+// sinkTimeout bounds every call of a sink, a sink that hangs (e.g. InfluxDB not answering) must not stall polling
+var sinkTimeout = 30 * time.Second
+
+// fanoutSink passes every call to all its sinks. The sinks are called concurrently and given up on after sinkTimeout,
+// so a sink failing or hanging doesn't hold up the others. A sink still busy with a call it was given up on
+// is skipped until that call returns, calls of one sink never overlap.
+// The returned error lists the sinks that failed.
+type fanoutSink []*namedSink
+
+func (f fanoutSink) each(fn func(Sink) error) error {
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(f)) //buffered, calls returning after the timeout must not block
+	var failed []string
+	pending := map[string]bool{}
+	for _, s := range f {
+		if !atomic.CompareAndSwapInt32(&s.busy, 0, 1) {
+			failed = append(failed, s.name+": previous call still running")
+			continue
+		}
+		pending[s.name] = true
+		go func(s *namedSink) {
+			err := fn(s.Sink)
+			atomic.StoreInt32(&s.busy, 0)
+			results <- result{s.name, err}
+		}(s)
+	}
+	timeout := time.NewTimer(sinkTimeout)
+	defer timeout.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			delete(pending, r.name)
+			if r.err != nil {
+				failed = append(failed, r.name+": "+r.err.Error())
+			}
+		case <-timeout.C:
+			for _, s := range f {
+				if pending[s.name] {
+					failed = append(failed, s.name+": no answer within "+sinkTimeout.String())
+				}
+			}
+			pending = nil
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (f fanoutSink) Announce(bridges []*systemBridge) error {
+	return f.each(func(s Sink) error {
+		return s.Announce(bridges)
+	})
+}
+
+func (f fanoutSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, sinkTimeout)
+	defer cancel()
+	return f.each(func(s Sink) error {
+		return s.Publish(ctx, sb, response, ts)
+	})
+}
+
+func (f fanoutSink) SetAvailable(sb *systemBridge, available bool) error {
+	return f.each(func(s Sink) error {
+		return s.SetAvailable(sb, available)
+	})
+}
+
+func (f fanoutSink) Close() error {
+	return f.each(func(s Sink) error {
+		return s.Close()
+	})
+}
+
+// logSink logs what would be published to MQTT, it replaces the MQTT sink in read-only mode (--ro)
+type logSink struct{}
+
+func (logSink) Announce(bridges []*systemBridge) error {
+	for _, sb := range bridges {
+		log.Info("system ", sb.system.Name, ": ", len(sb.params), " parameters")
+		for _, param := range sb.params {
+			log.Debug(param.Name, " -> ", sb.stateTopic(param.ParameterDescriptor))
+		}
+	}
+	return nil
+}
+
+func (logSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	for _, update := range sb.stateUpdates(response, ts) {
+		log.Info("dry run: ", update.topic, " <- ", update.payload)
+		sb.published(update, ts)
+	}
+	return nil
+}
+
+func (logSink) SetAvailable(sb *systemBridge, available bool) error {
+	log.Debug("dry run: ", sb.statusTopic(), " <- ", availabilityStatus(available))
+	return nil
+}
+
+func (logSink) Close() error {
+	return nil
+}
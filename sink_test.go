@@ -0,0 +1,120 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hangingSink blocks every Publish until release is closed, it fails when called again before that
+type hangingSink struct {
+	countingSink
+	release chan struct{}
+	running int32
+}
+
+func (s *hangingSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		return errors.New("called while still running")
+	}
+	defer atomic.StoreInt32(&s.running, 0)
+	<-s.release
+	return nil
+}
+
+// countingSink counts the calls it gets and fails them with err
+type countingSink struct {
+	calls int
+	err   error
+}
+
+func (s *countingSink) Announce(bridges []*systemBridge) error {
+	s.calls++
+	return s.err
+}
+
+func (s *countingSink) Publish(ctx context.Context, sb *systemBridge, response wolfsmartset.ParameterValuesResponse, ts time.Time) error {
+	s.calls++
+	return s.err
+}
+
+func (s *countingSink) SetAvailable(sb *systemBridge, available bool) error {
+	s.calls++
+	return s.err
+}
+
+func (s *countingSink) Close() error {
+	s.calls++
+	return s.err
+}
+
+func TestFanoutSink(t *testing.T) {
+	first, failing, last := &countingSink{}, &countingSink{err: errors.New("broker gone")}, &countingSink{}
+	sinks := fanoutSink{newNamedSink("first", first), newNamedSink("mqtt", failing), newNamedSink("last", last)}
+
+	if err := sinks.Announce(nil); err == nil || err.Error() != "mqtt: broker gone" {
+		t.Errorf("error = %v, want the error of the failing sink", err)
+	}
+	if err := sinks.Publish(context.Background(), &systemBridge{}, wolfsmartset.ParameterValuesResponse{}, time.Now()); err == nil {
+		t.Error("failing sink not reported")
+	}
+	for _, s := range []*countingSink{first, failing, last} {
+		if s.calls != 2 {
+			t.Errorf("sink called %d times, want 2", s.calls)
+		}
+	}
+
+	last.err = errors.New("disk full")
+	err := sinks.Close()
+	if err == nil || !strings.Contains(err.Error(), "mqtt: broker gone") || !strings.Contains(err.Error(), "last: disk full") {
+		t.Errorf("error = %v, want the errors of both failing sinks", err)
+	}
+}
+
+func TestFanoutSinkHanging(t *testing.T) {
+	defer func(timeout time.Duration) { sinkTimeout = timeout }(sinkTimeout)
+	sinkTimeout = 20 * time.Millisecond
+
+	hanging, other := &hangingSink{release: make(chan struct{})}, &countingSink{}
+	sinks := fanoutSink{newNamedSink("influx", hanging), newNamedSink("mqtt", other)}
+	publish := func() error {
+		return sinks.Publish(context.Background(), &systemBridge{}, wolfsmartset.ParameterValuesResponse{}, time.Now())
+	}
+
+	if err := publish(); err == nil || err.Error() != "influx: no answer within 20ms" {
+		t.Errorf("error = %v, want the hanging sink reported", err)
+	}
+	if err := publish(); err == nil || err.Error() != "influx: previous call still running" {
+		t.Errorf("error = %v, want the hanging sink skipped", err)
+	}
+	if other.calls != 2 {
+		t.Errorf("other sink called %d times, want 2", other.calls)
+	}
+
+	close(hanging.release)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&sinks[0].busy) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := publish(); err != nil {
+		t.Errorf("error = %v after the hanging sink returned", err)
+	}
+}
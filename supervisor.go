@@ -0,0 +1,59 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"math/rand"
+	"time"
+)
+
+const (
+	minRetryBackoff = 5 * time.Second
+	maxRetryBackoff = 5 * time.Minute
+)
+
+// supervise runs fn until it returns nil or a permanent error.
+// Transient failures (see wolfsmartset.IsTransient) are retried with exponential backoff and jitter,
+// the backoff starts over once fn ran longer than the maximum backoff. It returns nil once ctx is cancelled.
+func supervise(ctx context.Context, name string, fn func() error) error {
+	backoff := minRetryBackoff
+	for {
+		started := time.Now()
+		err := fn()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil || !wolfsmartset.IsTransient(err) {
+			return err
+		}
+		if time.Since(started) > maxRetryBackoff {
+			backoff = minRetryBackoff
+		}
+		//sleep somewhere between half and the full backoff so restarted instances don't hit the portal in sync
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+		log.Warn(name, " failed, retrying in ", wait.Round(time.Second), ". Error= ", err)
+		if !sleep(ctx, wait) {
+			return nil
+		}
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
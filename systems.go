@@ -0,0 +1,106 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemRow is a system as printed by the systems command
+type systemRow struct {
+	ID              int           `json:"id" yaml:"id"`
+	Name            string        `json:"name" yaml:"name"`
+	GatewayID       int           `json:"gatewayId" yaml:"gatewayId"`
+	GatewayUsername string        `json:"gatewayUsername" yaml:"gatewayUsername"`
+	SoftwareVersion string        `json:"softwareVersion" yaml:"softwareVersion"`
+	Foreign         bool          `json:"foreign" yaml:"foreign"`
+	AccessLevel     int           `json:"accessLevel" yaml:"accessLevel"`
+	Shares          []interface{} `json:"shares" yaml:"shares"`
+	// Selected tells whether --system picks the system, all systems are selected without --system
+	Selected bool `json:"selected" yaml:"selected"`
+}
+
+var systemsHeader = []string{"ID", "Name", "GatewayID", "GatewayUsername", "SoftwareVersion", "Foreign", "AccessLevel", "Shares", "Selected"}
+
+// runSystems prints all systems of the account, including those shared with it
+func runSystems(ctx context.Context) error {
+	tokens := newTokenManager(*wolfUser, *wolfPw)
+	if err := tokens.ensure(ctx); err != nil {
+		return err
+	}
+	sysList, err := portal.GetSystemList(ctx, tokens.accessToken())
+	if err != nil {
+		return err
+	}
+	selected := map[int]bool{}
+	for _, system := range selectSystems(sysList, *systemSelectors) {
+		selected[system.ID] = true
+	}
+
+	rows := make([]systemRow, 0, len(sysList))
+	var columns [][]string
+	for _, system := range sysList {
+		row := newSystemRow(system, selected[system.ID])
+		rows = append(rows, row)
+		columns = append(columns, row.columns())
+	}
+	return writeOutput(os.Stdout, *systemsFormat, rows, systemsHeader, columns)
+}
+
+func newSystemRow(system wolfsmartset.System, selected bool) systemRow {
+	shares := system.SystemShares
+	if shares == nil {
+		shares = []interface{}{}
+	}
+	return systemRow{
+		ID:              system.ID,
+		Name:            system.Name,
+		GatewayID:       system.GatewayID,
+		GatewayUsername: system.GatewayUsername,
+		SoftwareVersion: system.GatewaySoftwareVersion,
+		Foreign:         system.IsForeignSystem,
+		AccessLevel:     system.AccessLevel,
+		Shares:          shares,
+		Selected:        selected,
+	}
+}
+
+// columns returns the row as text in the order of systemsHeader, shares as compact JSON as the portal does not document them
+func (row systemRow) columns() []string {
+	var shares []string
+	for _, share := range row.Shares {
+		data, err := json.Marshal(share)
+		if err != nil {
+			continue
+		}
+		shares = append(shares, string(data))
+	}
+	return []string{
+		strconv.Itoa(row.ID),
+		row.Name,
+		strconv.Itoa(row.GatewayID),
+		row.GatewayUsername,
+		row.SoftwareVersion,
+		strconv.FormatBool(row.Foreign),
+		strconv.Itoa(row.AccessLevel),
+		strings.Join(shares, ", "),
+		strconv.FormatBool(row.Selected),
+	}
+}
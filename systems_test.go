@@ -0,0 +1,40 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"strings"
+	"testing"
+)
+
+func TestSystemRow(t *testing.T) {
+	system := wolfsmartset.System{ID: 4711, GatewayID: 1234, Name: "Haus", GatewayUsername: "gw", GatewaySoftwareVersion: "3.10.2",
+		IsForeignSystem: true, AccessLevel: 1, SystemShares: []interface{}{map[string]interface{}{"UserName": "anna", "AccessLevel": 1}}}
+
+	row := newSystemRow(system, true)
+	want := []string{"4711", "Haus", "1234", "gw", "3.10.2", "true", "1", `{"AccessLevel":1,"UserName":"anna"}`, "true"}
+	if got := row.columns(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("columns = %q, want %q", got, want)
+	}
+	if len(row.columns()) != len(systemsHeader) {
+		t.Errorf("%d columns for %d headers", len(row.columns()), len(systemsHeader))
+	}
+
+	unshared := newSystemRow(wolfsmartset.System{ID: 1}, false)
+	if unshared.Shares == nil || len(unshared.Shares) != 0 {
+		t.Errorf("shares = %#v, want an empty list so JSON has [] instead of null", unshared.Shares)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	log "github.com/sirupsen/logrus"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// topicTemplate as parsed from --topicTemplate
+var topicTemplate *template.Template
+
+// topicFields are available in --topicTemplate, text fields are slugs (see slugify).
+// Names without anything slugify keeps are replaced by the id (System, Name) or a short hash of the name.
+type topicFields struct {
+	Root        string
+	System      string
+	SystemID    int
+	Menu        string
+	Tab         string
+	Group       string
+	Name        string
+	ParameterID int64
+	ValueID     int64
+}
+
+// transliterations of characters common in the portal's languages
+var transliterations = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss",
+	"à", "a", "á", "a", "â", "a", "å", "a", "æ", "ae", "ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n", "ò", "o", "ó", "o", "ô", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ý", "y", "ÿ", "y",
+	"À", "A", "Á", "A", "Â", "A", "Å", "A", "Æ", "Ae", "Ç", "C", "È", "E", "É", "E", "Ê", "E",
+	"Ñ", "N", "Ò", "O", "Ó", "O", "Ô", "O", "Ø", "O", "Œ", "Oe", "Ù", "U", "Ú", "U", "Û", "U",
+	"°", "", "%", "pct",
+)
+
+// slugify turns a (localized) name into a topic level of ASCII letters, digits, '-' and '_'
+func slugify(name string) string {
+	name = transliterations.Replace(name)
+	var slug strings.Builder
+	underscore := false
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			slug.WriteRune(r)
+			underscore = false
+		} else if !underscore && slug.Len() > 0 {
+			slug.WriteRune('_')
+			underscore = true
+		}
+	}
+	return strings.TrimRight(slug.String(), "_")
+}
+
+// slugOr returns the slug of name, fallback if nothing of the name is left (e.g. names in Cyrillic)
+func slugOr(name, fallback string) string {
+	if slug := slugify(name); len(slug) > 0 {
+		return slug
+	}
+	return fallback
+}
+
+// slugOrHash returns the slug of name, a short hash of the name if nothing of it is left.
+// Empty names stay empty, executeTopicTemplate drops the level.
+func slugOrHash(name string) string {
+	if len(name) == 0 {
+		return ""
+	}
+	return slugOr(name, fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(name))))
+}
+
+func parseTopicTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("topic").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	//try it, this catches unknown fields
+	_, err = executeTopicTemplate(tmpl, topicFields{Root: "wolf", Name: "test"})
+	return tmpl, err
+}
+
+// executeTopicTemplate fills in the template, levels left empty (e.g. by a parameter without group) are dropped
+func executeTopicTemplate(tmpl *template.Template, fields topicFields) (string, error) {
+	var topic bytes.Buffer
+	if err := tmpl.Execute(&topic, fields); err != nil {
+		return "", err
+	}
+	var levels []string
+	for _, level := range strings.Split(topic.String(), "/") {
+		if len(level) > 0 {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, "/"), nil
+}
+
+// validTopic tells whether a topic can be published to (and subscribed to without wildcards)
+func validTopic(topic string) bool {
+	if len(topic) == 0 || strings.ContainsAny(topic, "+#\x00") {
+		return false
+	}
+	for _, level := range strings.Split(topic, "/") {
+		if len(level) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// buildTopics determines the topic of every parameter of the system, below which state and set are published.
+// If two parameters end up with the same topic the value id is appended to the later one.
+func (sb *systemBridge) buildTopics() error {
+	sb.topics = map[int64]string{}
+	used := map[string]int64{}
+	for _, param := range sb.params {
+		topic := sb.paramConfig(param.ParameterDescriptor).Topic
+		if len(topic) == 0 {
+			var err error
+			topic, err = executeTopicTemplate(topicTemplate, topicFields{
+				Root:        sb.topicRoot,
+				System:      slugOr(sb.system.Name, strconv.Itoa(sb.system.ID)),
+				SystemID:    sb.system.ID,
+				Menu:        slugOrHash(param.MenuItem),
+				Tab:         slugOrHash(param.TabName),
+				Group:       slugOrHash(param.Group),
+				Name:        slugOr(sb.paramName(param.ParameterDescriptor), strconv.FormatInt(param.ValueID, 10)),
+				ParameterID: param.ParameterID,
+				ValueID:     param.ValueID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if other, collides := used[topic]; collides {
+			unique := fmt.Sprintf("%s_%d", topic, param.ValueID)
+			log.Warn("topic ", topic, " of value id ", param.ValueID, " is already used by value id ", other, ", using ", unique)
+			topic = unique
+		}
+		if !validTopic(topic) {
+			return fmt.Errorf("'%s' (parameter %s) is not a valid MQTT topic", topic, param.Name)
+		}
+		used[topic] = param.ValueID
+		sb.topics[param.ValueID] = topic
+	}
+	return nil
+}
+
+// uniqueParams drops parameters shown on more than one tab, these have the same value id
+func uniqueParams(params []wolfsmartset.MenuParameter) []wolfsmartset.MenuParameter {
+	seen := map[int64]bool{}
+	var unique []wolfsmartset.MenuParameter
+	for _, param := range params {
+		if !seen[param.ValueID] {
+			seen[param.ValueID] = true
+			unique = append(unique, param)
+		}
+	}
+	return unique
+}
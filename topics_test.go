@@ -0,0 +1,180 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Kesseltemperatur", "Kesseltemperatur"},
+		{"Außentemperatur", "Aussentemperatur"},
+		{"Heizgerät", "Heizgeraet"},
+		{"Heizkreis 1 / Vorlauf", "Heizkreis_1_Vorlauf"},
+		{"  Temp. (°C)", "Temp_C"},
+		{"Modulation %", "Modulation_pct"},
+		{"Sollwert-Korrektur", "Sollwert-Korrektur"},
+		{"a+b#c", "a_b_c"},
+		{"+/#", ""},
+		{"Температура", ""},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.name); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildTopics(t *testing.T) {
+	param := func(valueID int64, menu string, name string) wolfsmartset.MenuParameter {
+		return wolfsmartset.MenuParameter{MenuItem: menu, ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: valueID, Name: name}}
+	}
+	tests := []struct {
+		name     string
+		template string
+		system   string
+		params   []wolfsmartset.MenuParameter
+		configs  map[int64]parameterConfig
+		want     map[int64]string
+		wantErr  bool
+	}{
+		{
+			name:   "default",
+			params: []wolfsmartset.MenuParameter{param(1001, "Heizgerät", "Kesseltemperatur"), param(1013, "Heizkreis 2", "Vorlauftemperatur")},
+			want:   map[int64]string{1001: "wolf/Heizgeraet/1001", 1013: "wolf/Heizkreis_2/1013"},
+		},
+		{
+			name:   "empty menu",
+			params: []wolfsmartset.MenuParameter{param(1001, "", "Kesseltemperatur")},
+			want:   map[int64]string{1001: "wolf/1001"},
+		},
+		{
+			name:     "empty group",
+			template: "{{.Root}}/{{.Group}}/{{.Name}}",
+			params:   []wolfsmartset.MenuParameter{param(1001, "Heizgerät", "Kesseltemperatur")},
+			want:     map[int64]string{1001: "wolf/Kesseltemperatur"},
+		},
+		{
+			name:     "collision",
+			template: "{{.Root}}/{{.Name}}",
+			params:   []wolfsmartset.MenuParameter{param(1013, "Heizkreis 1", "Vorlauftemperatur"), param(1113, "Heizkreis 2", "Vorlauftemperatur")},
+			want:     map[int64]string{1013: "wolf/Vorlauftemperatur", 1113: "wolf/Vorlauftemperatur_1113"},
+		},
+		{
+			name:     "name",
+			template: "{{.Root}}/{{.Name}}",
+			params:   []wolfsmartset.MenuParameter{param(1001, "Heizgerät", "Kesseltemperatur"), param(1013, "Heizkreis 2", "Vorlauftemperatur")},
+			want:     map[int64]string{1001: "wolf/Kesseltemperatur", 1013: "wolf/Vorlauftemperatur"},
+		},
+		{
+			name:     "name without latin letters",
+			template: "{{.Root}}/{{.Name}}",
+			params:   []wolfsmartset.MenuParameter{param(1001, "Котёл", "Температура")},
+			want:     map[int64]string{1001: "wolf/1001"},
+		},
+		{
+			name:     "system without latin letters",
+			template: "{{.Root}}/{{.System}}/{{.ValueID}}",
+			system:   "Дом",
+			params:   []wolfsmartset.MenuParameter{param(1001, "Heizgerät", "Kesseltemperatur")},
+			want:     map[int64]string{1001: "wolf/4711/1001"},
+		},
+		{
+			name:    "topic from config",
+			params:  []wolfsmartset.MenuParameter{param(1011, "Heizkreis", "Betriebsart")},
+			configs: map[int64]parameterConfig{1011: {Topic: "wolf/mode"}},
+			want:    map[int64]string{1011: "wolf/mode"},
+		},
+		{
+			name:    "invalid topic from config",
+			params:  []wolfsmartset.MenuParameter{param(1011, "Heizkreis", "Betriebsart")},
+			configs: map[int64]parameterConfig{1011: {Topic: "wolf/+/mode"}},
+			wantErr: true,
+		},
+	}
+	defaultTemplate := topicTemplate
+	defer func() { topicTemplate = defaultTemplate }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topicTemplate = defaultTemplate
+			if len(tt.template) > 0 {
+				var err error
+				if topicTemplate, err = parseTopicTemplate(tt.template); err != nil {
+					t.Fatal(err)
+				}
+			}
+			system := tt.system
+			if len(system) == 0 {
+				system = "Haus"
+			}
+			sb := &systemBridge{
+				system:       wolfsmartset.System{ID: 4711, Name: system},
+				topicRoot:    "wolf",
+				params:       tt.params,
+				paramConfigs: tt.configs,
+			}
+			err := sb.buildTopics()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildTopics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for valueID, want := range tt.want {
+				if got := sb.topics[valueID]; got != want {
+					t.Errorf("topic of %d = %q, want %q", valueID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMenuWithoutLatinLetters(t *testing.T) {
+	defaultTemplate := topicTemplate
+	defer func() { topicTemplate = defaultTemplate }()
+	var err error
+	if topicTemplate, err = parseTopicTemplate("{{.Root}}/{{.Menu}}/{{.ValueID}}"); err != nil {
+		t.Fatal(err)
+	}
+	sb := &systemBridge{
+		system:    wolfsmartset.System{ID: 4711, Name: "Haus"},
+		topicRoot: "wolf",
+		params: []wolfsmartset.MenuParameter{
+			{MenuItem: "Котёл", ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1001}},
+			{MenuItem: "Отопление", ParameterDescriptor: wolfsmartset.ParameterDescriptor{ValueID: 1011}},
+		},
+	}
+	if err := sb.buildTopics(); err != nil {
+		t.Fatal(err)
+	}
+	boiler, heating := sb.topics[1001], sb.topics[1011]
+	if !validTopic(boiler) || !strings.HasSuffix(boiler, "/1001") {
+		t.Errorf("topic = %q, want a valid topic ending with the value id", boiler)
+	}
+	if strings.TrimSuffix(boiler, "/1001") == strings.TrimSuffix(heating, "/1011") {
+		t.Errorf("menus got the same topic level: %q, %q", boiler, heating)
+	}
+}
+
+func TestParseTopicTemplate(t *testing.T) {
+	for _, invalid := range []string{"{{.Root}}/{{.Unknown}}", "{{.Root"} {
+		if _, err := parseTopicTemplate(invalid); err == nil {
+			t.Errorf("parseTopicTemplate(%q) accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"time"
+)
+
+// parameterState is the payload published for a parameter in JSON mode.
+// Value is a number for numeric parameters and the display text for list parameters, Raw is the value as sent by the portal.
+type parameterState struct {
+	Value interface{} `json:"value"`
+	Raw   string      `json:"raw"`
+	Unit  string      `json:"unit,omitempty"`
+	State int         `json:"state"`
+	Ts    time.Time   `json:"ts"`
+}
+
+// jsonStateEnabled tells whether the state of a parameter is published as JSON instead of the plain value
+func jsonStateEnabled(param wolfsmartset.ParameterDescriptor) bool {
+	if *brJsonState {
+		return true
+	}
+	for _, selector := range *brJsonParams {
+		if matchesParam(selector, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatState returns the payload to publish for a value, the display text for list parameters
+// or the raw value unless the parameter is published asJSON
+func formatState(param wolfsmartset.ParameterDescriptor, value wolfsmartset.ParameterValue, ts time.Time, asJSON bool) (string, error) {
+	if !asJSON {
+		return param.DisplayValue(value.Value), nil
+	}
+
+	payload, err := json.Marshal(newParameterState(param, value, ts))
+	return string(payload), err
+}
+
+// newParameterState returns the state of a value as published in JSON mode
+func newParameterState(param wolfsmartset.ParameterDescriptor, value wolfsmartset.ParameterValue, ts time.Time) parameterState {
+	state := parameterState{Raw: value.Value, Unit: param.Unit, State: value.State, Ts: ts}
+	if numeric, ok := param.NumericValue(value.Value); ok {
+		state.Value = numeric
+	} else {
+		state.Value = param.DisplayValue(value.Value)
+	}
+	return state
+}
@@ -0,0 +1,136 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/matryer/runner"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// refresh the access token this long before it expires at the latest
+const maxTokenRefreshAhead = 5 * time.Minute
+
+// tokenManager keeps the portal access token valid.
+// The token is refreshed ahead of expiry using the refresh token, a login with the password
+// is only done when the portal rejects the refresh.
+type tokenManager struct {
+	sync.RWMutex
+	username string
+	password string
+	token    wolfsmartset.AuthToken
+	expires  time.Time
+}
+
+// newTokenManager creates a token manager for the user, it logs in on the first call to ensure
+func newTokenManager(username string, password string) *tokenManager {
+	return &tokenManager{username: username, password: password}
+}
+
+// accessToken returns the current access token
+func (m *tokenManager) accessToken() string {
+	m.RLock()
+	defer m.RUnlock()
+	return m.token.AccessToken
+}
+
+func (m *tokenManager) setToken(token wolfsmartset.AuthToken) {
+	m.Lock()
+	defer m.Unlock()
+	m.token = token
+	m.expires = time.Time{}
+	if token.ExpiresIn > 0 {
+		m.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+}
+
+func (m *tokenManager) login(ctx context.Context) error {
+	log.Debug("obtain auth token ", "user", m.username)
+	portalLogins.Inc()
+	token, err := portal.GetAuthToken(ctx, m.username, m.password)
+	if err != nil {
+		return err
+	}
+	m.setToken(token)
+	return nil
+}
+
+// ensure logs in if there is no token yet and renews it otherwise
+func (m *tokenManager) ensure(ctx context.Context) error {
+	m.RLock()
+	hasToken := len(m.token.AccessToken) > 0
+	m.RUnlock()
+	if !hasToken {
+		return m.login(ctx)
+	}
+	return m.refresh(ctx)
+}
+
+// refresh obtains a new access token, using the refresh token if there is one
+func (m *tokenManager) refresh(ctx context.Context) error {
+	m.RLock()
+	refreshToken := m.token.RefreshToken
+	m.RUnlock()
+
+	if len(refreshToken) > 0 {
+		log.Debug("refreshing auth token")
+		tokenRefreshes.Inc()
+		token, err := portal.RefreshAuthToken(ctx, refreshToken)
+		if err == nil {
+			m.setToken(token)
+			return nil
+		}
+		if !errors.Is(err, wolfsmartset.ErrBadCredentials) {
+			return err
+		}
+		log.Warn("token refresh rejected, logging in again. Error= ", err)
+	}
+	return m.login(ctx)
+}
+
+// refreshDue tells whether the token is about to expire
+func (m *tokenManager) refreshDue() bool {
+	m.RLock()
+	defer m.RUnlock()
+	if m.expires.IsZero() {
+		return false //lifetime unknown, wait for a request to fail
+	}
+	ahead := time.Duration(m.token.ExpiresIn) * time.Second / 4
+	if ahead > maxTokenRefreshAhead {
+		ahead = maxTokenRefreshAhead
+	}
+	return time.Now().Add(ahead).After(m.expires)
+}
+
+// keepFresh refreshes the token before it expires until stopped or ctx is cancelled, run this with runner.Go
+func (m *tokenManager) keepFresh(ctx context.Context, shouldStop runner.S) error {
+	for !shouldStop() {
+		if m.refreshDue() {
+			err := m.refresh(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Error("failed to refresh auth token ", err)
+				sleep(ctx, 10*time.Second) //don't hammer the portal
+			}
+		}
+		if !sleep(ctx, time.Second) {
+			break
+		}
+	}
+	return nil
+}
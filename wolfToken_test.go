@@ -0,0 +1,182 @@
+package main
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"fmt"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenEndpoint answers password logins with a new token each and refresh requests with refreshStatus, or a token if 200
+type tokenEndpoint struct {
+	sync.Mutex
+	refreshStatus int
+	logins        int
+	refreshes     int
+}
+
+func (e *tokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+	switch r.FormValue("grant_type") {
+	case "password":
+		e.logins++
+	case "refresh_token":
+		e.refreshes++
+		if e.refreshStatus != http.StatusOK {
+			w.WriteHeader(e.refreshStatus)
+			return
+		}
+	}
+	n := e.logins + e.refreshes
+	fmt.Fprintf(w, `{"access_token":"access%d","expires_in":3600,"refresh_token":"refresh%d"}`, n, n)
+}
+
+// useTokenEndpoint points the portal client to a server answering token requests with e, close the server when done
+func useTokenEndpoint(t *testing.T, e *tokenEndpoint) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(e)
+	portal = wolfsmartset.NewClient(server.Client())
+	if err := portal.SetBaseURL(server.URL + "/portal/"); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestRefreshInsteadOfLogin(t *testing.T) {
+	endpoint := &tokenEndpoint{refreshStatus: http.StatusOK}
+	server := useTokenEndpoint(t, endpoint)
+	defer server.Close()
+	tokens := newTokenManager("user", "secret")
+
+	if err := tokens.ensure(context.Background()); err != nil {
+		t.Fatal("login failed: ", err)
+	}
+	first := tokens.accessToken()
+	if err := tokens.ensure(context.Background()); err != nil {
+		t.Fatal("refresh failed: ", err)
+	}
+	if tokens.accessToken() == first {
+		t.Error("the token was not renewed")
+	}
+	if endpoint.logins != 1 || endpoint.refreshes != 1 {
+		t.Errorf("%d logins and %d refreshes, want 1 each", endpoint.logins, endpoint.refreshes)
+	}
+}
+
+func TestTokenRefreshAfterExpiry(t *testing.T) {
+	sim, server := useSimulator(t)
+	defer server.Close()
+	ctx := context.Background()
+	tokens := newTokenManager("user", "secret")
+	if err := tokens.ensure(ctx); err != nil {
+		t.Fatal("login failed: ", err)
+	}
+	expired := tokens.accessToken()
+
+	sim.ExpireTokens()
+	_, err := portal.GetSystemList(ctx, expired)
+	if !wolfsmartset.IsTransient(err) {
+		t.Fatalf("request with expired token: error = %v, want a transient error", err)
+	}
+
+	logins := testutil.ToFloat64(portalLogins)
+	if err := tokens.ensure(ctx); err != nil {
+		t.Fatal("refresh failed: ", err)
+	}
+	if tokens.accessToken() == expired {
+		t.Error("the token was not renewed")
+	}
+	if testutil.ToFloat64(portalLogins) != logins {
+		t.Error("logged in again instead of using the refresh token")
+	}
+	if _, err := portal.GetSystemList(ctx, tokens.accessToken()); err != nil {
+		t.Errorf("request with refreshed token failed: %v", err)
+	}
+}
+
+func TestReloginWhenRefreshIsRejected(t *testing.T) {
+	endpoint := &tokenEndpoint{refreshStatus: http.StatusBadRequest}
+	server := useTokenEndpoint(t, endpoint)
+	defer server.Close()
+	tokens := newTokenManager("user", "secret")
+
+	if err := tokens.ensure(context.Background()); err != nil {
+		t.Fatal("login failed: ", err)
+	}
+	first := tokens.accessToken()
+	if err := tokens.ensure(context.Background()); err != nil {
+		t.Fatal("login after rejected refresh failed: ", err)
+	}
+	if tokens.accessToken() == first {
+		t.Error("the token was not renewed")
+	}
+	if endpoint.logins != 2 {
+		t.Errorf("logged in %d times, want 2", endpoint.logins)
+	}
+}
+
+func TestTokenErrorIsNotRetriedAsLogin(t *testing.T) {
+	endpoint := &tokenEndpoint{refreshStatus: http.StatusServiceUnavailable}
+	server := useTokenEndpoint(t, endpoint)
+	defer server.Close()
+	tokens := newTokenManager("user", "secret")
+
+	if err := tokens.ensure(context.Background()); err != nil {
+		t.Fatal("login failed: ", err)
+	}
+	if err := tokens.ensure(context.Background()); !wolfsmartset.IsTransient(err) {
+		t.Errorf("error = %v, want the transient error of the refresh", err)
+	}
+	if endpoint.logins != 1 {
+		t.Error("a portal outage must not lead to logging in again")
+	}
+}
+
+func TestRefreshDue(t *testing.T) {
+	tokens := newTokenManager("user", "secret")
+	if tokens.refreshDue() {
+		t.Error("refresh due without token")
+	}
+	tokens.setToken(wolfsmartset.AuthToken{AccessToken: "a", ExpiresIn: 3600})
+	if tokens.refreshDue() {
+		t.Error("refresh due right after login")
+	}
+	tokens.expires = time.Now().Add(4 * time.Minute) //less than maxTokenRefreshAhead left
+	if !tokens.refreshDue() {
+		t.Error("refresh not due shortly before expiry")
+	}
+	tokens.setToken(wolfsmartset.AuthToken{AccessToken: "b", ExpiresIn: 120})
+	tokens.expires = time.Now().Add(time.Minute) //short lived tokens are refreshed a quarter of their lifetime ahead
+	if tokens.refreshDue() {
+		t.Error("refresh due with more than a quarter of the lifetime left")
+	}
+	tokens.expires = time.Now().Add(20 * time.Second)
+	if !tokens.refreshDue() {
+		t.Error("refresh not due with less than a quarter of the lifetime left")
+	}
+	tokens.setToken(wolfsmartset.AuthToken{AccessToken: "c"})
+	if tokens.refreshDue() {
+		t.Error("refresh due for a token of unknown lifetime")
+	}
+}
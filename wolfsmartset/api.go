@@ -0,0 +1,198 @@
+package wolfsmartset
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	authenticatePath    = "connect/token2"
+	createSessionPath   = "api/portal/CreateSession"
+	refreshSessionPath  = "api/portal/UpdateSession"
+	systemListPath      = "api/portal/GetSystemList"
+	guiDescriptionPath  = "api/portal/GetGuiDescriptionForGateway"
+	parameterValuesPath = "api/portal/GetParameterValues"
+	writeValuesPath     = "api/portal/WriteParameterValues"
+)
+
+// GetAuthToken logs in with username and password
+func (c *Client) GetAuthToken(ctx context.Context, username string, password string) (AuthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "password")
+	form.Set("username", username)
+	form.Set("password", password)
+	form.Set("scope", "all")
+	return c.requestToken(ctx, "GetAuthToken", form)
+}
+
+// RefreshAuthToken obtains a new access token using the refresh_token grant
+func (c *Client) RefreshAuthToken(ctx context.Context, refreshToken string) (AuthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("scope", "all")
+	return c.requestToken(ctx, "RefreshAuthToken", form)
+}
+
+func (c *Client) requestToken(ctx context.Context, op string, form url.Values) (AuthToken, error) {
+	data := AuthToken{}
+
+	req, err := c.newRequest(ctx, "POST", authenticatePath, "", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return data, err
+	}
+	body, err := c.do(op, req)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			switch statusErr.StatusCode {
+			case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+				statusErr.Err = ErrBadCredentials
+			}
+		}
+		return data, err
+	}
+	err = decode(op, body, &data)
+	return data, err
+}
+
+// CreateSession opens a portal session, the returned session id is needed to query values
+func (c *Client) CreateSession(ctx context.Context, bearerToken string) (int, error) {
+	payload := strings.NewReader("{\n    \"Timestamp\": \"2019-11-04 21:53:50\"\n}")
+	req, err := c.newRequest(ctx, "POST", createSessionPath, bearerToken, "application/json", payload)
+	if err != nil {
+		return 0, err
+	}
+	body, err := c.do("CreateSession", req)
+	if err != nil {
+		return 0, err
+	}
+
+	var sessId int
+	_, err = fmt.Fscanf(bytes.NewReader(body), "%d", &sessId)
+	if err != nil {
+		return 0, &ProtocolError{Op: "CreateSession", Err: err}
+	}
+	return sessId, nil
+}
+
+// RefreshSession keeps a session alive, the portal drops sessions that are not refreshed every few minutes
+func (c *Client) RefreshSession(ctx context.Context, bearerToken string, sessionId int) error {
+	payload, err := json.Marshal(SessionStr{sessionId})
+	if err != nil {
+		return err
+	}
+	log.Debug("refreshing session")
+
+	req, err := c.newRequest(ctx, "POST", refreshSessionPath, bearerToken, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	_, err = c.do("RefreshSession", req)
+	return err
+}
+
+// GetSystemList returns the systems the user has access to
+func (c *Client) GetSystemList(ctx context.Context, bearerToken string) (SystemList, error) {
+	data := SystemList{}
+
+	req, err := c.newRequest(ctx, "GET", systemListPath, bearerToken, "", nil)
+	if err != nil {
+		return data, err
+	}
+	body, err := c.do("GetSystemList", req)
+	if err != nil {
+		return data, err
+	}
+	err = decode("GetSystemList", body, &data)
+	return data, err
+}
+
+// GetGUIDescriptionForGateway returns the menu structure and parameter descriptors of a system
+func (c *Client) GetGUIDescriptionForGateway(ctx context.Context, bearerToken string, gatewayId int, systemId int) (GuiDescription, error) {
+	data := GuiDescription{}
+
+	path := fmt.Sprintf("%s?GatewayId=%d&SystemId=%d", guiDescriptionPath, gatewayId, systemId)
+	req, err := c.newRequest(ctx, "GET", path, bearerToken, "", nil)
+	if err != nil {
+		return data, err
+	}
+	body, err := c.do("GetGuiDescriptionForGateway", req)
+	if err != nil {
+		return data, err
+	}
+	err = decode("GetGuiDescriptionForGateway", body, &data)
+	return data, err
+}
+
+// GetParameterValues fetches the current values of the given value ids
+func (c *Client) GetParameterValues(ctx context.Context, bearerToken string, sessionId int, valueIDList []int64, lastUpdate string, sys System) (ParameterValuesResponse, error) {
+	reqPayload := ParameterValuesRequest{1000, false,
+		valueIDList,
+		sys.GatewayID, sys.ID,
+		"2019-11-22T19:35:06.7715496Z", false, sessionId}
+	response := ParameterValuesResponse{}
+	payload, err := json.Marshal(reqPayload)
+	if err != nil {
+		return response, err
+	}
+	log.Trace("request: ", string(payload))
+
+	req, err := c.newRequest(ctx, "POST", parameterValuesPath, bearerToken, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return response, err
+	}
+	body, err := c.do("GetParameterValues", req)
+	if err != nil {
+		return response, err
+	}
+	err = decode("GetParameterValues", body, &response)
+	return response, err
+}
+
+// WriteParameterValues sets one or more parameters of a system, values must already be validated
+func (c *Client) WriteParameterValues(ctx context.Context, bearerToken string, sessionId int, values []WriteParameterValue, sys System) error {
+	reqPayload := WriteParameterValuesRequest{
+		WriteParameterValues: values,
+		SystemID:             sys.ID,
+		GatewayID:            sys.GatewayID,
+		BundleID:             1000,
+		IsSubBundle:          false,
+		GuiIDChanged:         false,
+		SessionID:            sessionId,
+	}
+	payload, err := json.Marshal(reqPayload)
+	if err != nil {
+		return err
+	}
+	log.Debug("write parameter values: ", string(payload))
+
+	req, err := c.newRequest(ctx, "POST", writeValuesPath, bearerToken, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	_, err = c.do("WriteParameterValues", req)
+	return err
+}
@@ -0,0 +1,122 @@
+// Package wolfsmartset is a client for the (re-engineered) API of the Wolf Smartset portal
+// at https://www.wolf-smartset.com
+package wolfsmartset
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultBaseURL is the address of the Wolf Smartset portal
+const DefaultBaseURL = "https://www.wolf-smartset.com/portal/"
+
+const defaultUserAgent = "WolfMQTTBridge/1.0"
+
+// Client talks to the Wolf Smartset portal. It holds no login state, the bearer token
+// and session id are passed to every call.
+type Client struct {
+	// BaseURL of the portal, must end with a slash
+	BaseURL *url.URL
+	// UserAgent sent with every request
+	UserAgent string
+
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the portal at DefaultBaseURL.
+// If httpClient is nil http.DefaultClient is used.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	baseURL, _ := url.Parse(DefaultBaseURL)
+	return &Client{BaseURL: baseURL, UserAgent: defaultUserAgent, httpClient: httpClient}
+}
+
+// SetBaseURL points the client to another portal address, e.g. a test server
+func (c *Client) SetBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if len(u.Path) == 0 || u.Path[len(u.Path)-1] != '/' {
+		u.Path += "/"
+	}
+	c.BaseURL = u
+	return nil
+}
+
+// newRequest creates a request for path relative to BaseURL, a bearerToken is added when not empty
+func (c *Client) newRequest(ctx context.Context, method string, path string, bearerToken string, contentType string, body io.Reader) (*http.Request, error) {
+	u, err := c.BaseURL.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if len(contentType) > 0 {
+		req.Header.Add("Content-Type", contentType)
+	}
+	req.Header.Add("cache-control", "no-cache")
+	if len(bearerToken) > 0 {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
+	}
+	req.Header.Add("Connection", "keep-alive")
+	req.Header.Add("User-Agent", c.UserAgent)
+	req.Header.Add("Accept", "*/*")
+	req.Header.Add("X-Pect", "The Spanish Inquisition")
+	return req, nil
+}
+
+// do executes the request and returns the response body, any status but 200 is a *StatusError
+func (c *Client) do(op string, req *http.Request) ([]byte, error) {
+	log.Trace(op, ": ", req.Method, " ", req.URL)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &TransportError{Op: op, Err: err}
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, &TransportError{Op: op, Err: err}
+	}
+	log.Trace(op, ": status ", res.Status, " response ", string(body))
+
+	if res.StatusCode != http.StatusOK {
+		return body, newStatusError(op, res, body)
+	}
+	return body, nil
+}
+
+// decode unmarshals a response body, failures are reported as *ProtocolError
+func decode(op string, body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return &ProtocolError{Op: op, Err: err}
+	}
+	return nil
+}
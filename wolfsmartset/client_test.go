@@ -0,0 +1,273 @@
+package wolfsmartset_test
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset/simulator"
+)
+
+// newTestServer serves handler under /portal/ and returns a client using it
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *wolfsmartset.Client) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	client := wolfsmartset.NewClient(server.Client())
+	if err := client.SetBaseURL(server.URL + "/portal"); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return server, client
+}
+
+func TestGetAuthToken(t *testing.T) {
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/portal/connect/token2" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("grant_type") != "password" || r.FormValue("username") != "user" || r.FormValue("password") != "secret" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"access","expires_in":3600,"refresh_token":"refresh"}`)
+	})
+	defer server.Close()
+
+	token, err := client.GetAuthToken(context.Background(), "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" || token.RefreshToken != "refresh" || token.ExpiresIn != 3600 {
+		t.Errorf("token = %+v", token)
+	}
+}
+
+func TestGetSystemList(t *testing.T) {
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/portal/api/portal/GetSystemList" || r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `[{"Id":4711,"GatewayId":1234,"Name":"Haus"}]`)
+	})
+	defer server.Close()
+
+	systems, err := client.GetSystemList(context.Background(), "access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(systems) != 1 || systems[0].ID != 4711 || systems[0].GatewayID != 1234 || systems[0].Name != "Haus" {
+		t.Errorf("systems = %+v", systems)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+
+	_, err := client.GetSystemList(context.Background(), "access")
+	var statusErr *wolfsmartset.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("error = %v, want *StatusError with status 503", err)
+	}
+	if statusErr.Op != "GetSystemList" {
+		t.Errorf("Op = %q, want GetSystemList", statusErr.Op)
+	}
+}
+
+func TestUnexpectedResponse(t *testing.T) {
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>maintenance</html>")
+	})
+	defer server.Close()
+
+	_, err := client.GetSystemList(context.Background(), "access")
+	var protocolErr *wolfsmartset.ProtocolError
+	if !errors.As(err, &protocolErr) || !errors.Is(err, wolfsmartset.ErrProtocol) {
+		t.Errorf("error = %v, want *ProtocolError", err)
+	}
+	_, err = client.CreateSession(context.Background(), "access")
+	if !errors.As(err, &protocolErr) || !errors.Is(err, wolfsmartset.ErrProtocol) {
+		t.Errorf("CreateSession error = %v, want *ProtocolError", err)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		token  bool // request a token instead of the system list
+		status int
+		want   error
+	}{
+		{false, http.StatusInternalServerError, wolfsmartset.ErrTransient},
+		{false, http.StatusServiceUnavailable, wolfsmartset.ErrTransient},
+		{false, http.StatusUnauthorized, wolfsmartset.ErrTransient},
+		{false, http.StatusNotFound, wolfsmartset.ErrProtocol},
+		{false, http.StatusMethodNotAllowed, wolfsmartset.ErrProtocol},
+		{false, http.StatusGone, wolfsmartset.ErrProtocol},
+		{true, http.StatusBadRequest, wolfsmartset.ErrBadCredentials},
+		{true, http.StatusUnauthorized, wolfsmartset.ErrBadCredentials},
+		{true, http.StatusForbidden, wolfsmartset.ErrBadCredentials},
+		{true, http.StatusBadGateway, wolfsmartset.ErrTransient},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("token %v %d", tt.token, tt.status), func(t *testing.T) {
+			server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			})
+			defer server.Close()
+
+			var err error
+			if tt.token {
+				_, err = client.GetAuthToken(context.Background(), "user", "secret")
+			} else {
+				_, err = client.GetSystemList(context.Background(), "access")
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+			if got := wolfsmartset.IsTransient(err); got != (tt.want == wolfsmartset.ErrTransient) {
+				t.Errorf("IsTransient(%v) = %v", err, got)
+			}
+			var statusErr *wolfsmartset.StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+				t.Errorf("error = %v, want *StatusError with status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestPortalUnreachable(t *testing.T) {
+	server, client := newTestServer(t, http.NotFound)
+	server.Close()
+
+	_, err := client.GetSystemList(context.Background(), "access")
+	var transportErr *wolfsmartset.TransportError
+	if !errors.As(err, &transportErr) || !wolfsmartset.IsTransient(err) {
+		t.Errorf("error = %v, want transient *TransportError", err)
+	}
+}
+
+const testSystemID = 4711
+
+// newSimulatedClient starts a simulated portal with the default fixtures and returns a client using it
+func newSimulatedClient(t *testing.T, opts simulator.Options) (*simulator.Portal, *httptest.Server, *wolfsmartset.Client) {
+	t.Helper()
+	portal, server := simulator.NewServer(simulator.DefaultFixtures(), opts)
+	client := wolfsmartset.NewClient(server.Client())
+	if err := client.SetBaseURL(server.URL + "/portal/"); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return portal, server, client
+}
+
+func login(t *testing.T, client *wolfsmartset.Client) wolfsmartset.AuthToken {
+	t.Helper()
+	token, err := client.GetAuthToken(context.Background(), "user", "secret")
+	if err != nil {
+		t.Fatal("login failed: ", err)
+	}
+	return token
+}
+
+func TestPollAndWrite(t *testing.T) {
+	portal, server, client := newSimulatedClient(t, simulator.Options{Username: "user", Password: "secret"})
+	defer server.Close()
+	ctx := context.Background()
+	token := login(t, client)
+
+	sessId, err := client.CreateSession(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	systems, err := client.GetSystemList(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(systems) != 1 || systems[0].ID != testSystemID {
+		t.Fatalf("systems = %+v, want system %d", systems, testSystemID)
+	}
+	system := systems[0]
+	guiDescription, err := client.GetGUIDescriptionForGateway(ctx, token.AccessToken, system.GatewayID, system.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var valIdList []int64
+	for _, param := range guiDescription.Parameters() {
+		valIdList = append(valIdList, param.ValueID)
+	}
+	values, err := client.GetParameterValues(ctx, token.AccessToken, sessId, valIdList, "2019-12-06T18:11:40.3881067Z", system)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values.Values) != len(valIdList) {
+		t.Errorf("got %d values, want %d", len(values.Values), len(valIdList))
+	}
+
+	err = client.WriteParameterValues(ctx, token.AccessToken, sessId, []wolfsmartset.WriteParameterValue{{ValueID: 1012, Value: "22.5"}}, system)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := portal.Value(testSystemID, 1012); value != "22.5" {
+		t.Errorf("value after write = %q, want 22.5", value)
+	}
+}
+
+func TestExpiredTokenAndRefresh(t *testing.T) {
+	portal, server, client := newSimulatedClient(t, simulator.Options{})
+	defer server.Close()
+	ctx := context.Background()
+	token := login(t, client)
+
+	portal.ExpireTokens()
+	_, err := client.GetSystemList(ctx, token.AccessToken)
+	var statusErr *wolfsmartset.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("error = %v, want status 401", err)
+	}
+	if !wolfsmartset.IsTransient(err) {
+		t.Errorf("an expired token must be transient, got %v", err)
+	}
+
+	refreshed, err := client.RefreshAuthToken(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatal("refresh failed: ", err)
+	}
+	if refreshed.AccessToken == token.AccessToken {
+		t.Error("refresh returned the expired access token")
+	}
+	if _, err := client.GetSystemList(ctx, refreshed.AccessToken); err != nil {
+		t.Errorf("request with refreshed token failed: %v", err)
+	}
+
+	//refresh tokens can only be used once, a rejected refresh means logging in again
+	_, err = client.RefreshAuthToken(ctx, token.RefreshToken)
+	if !errors.Is(err, wolfsmartset.ErrBadCredentials) {
+		t.Errorf("reusing a refresh token: error = %v, want ErrBadCredentials", err)
+	}
+	relogin := login(t, client)
+	if _, err := client.GetSystemList(ctx, relogin.AccessToken); err != nil {
+		t.Errorf("request after logging in again failed: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package wolfsmartset
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the client wrap one of these, use errors.Is to tell them apart
+var (
+	// ErrBadCredentials means the portal rejected the username/password or the refresh token
+	ErrBadCredentials = errors.New("wolfsmartset: bad credentials")
+	// ErrTransient means the request may succeed when retried later, e.g. network trouble,
+	// portal maintenance or an expired access token
+	ErrTransient = errors.New("wolfsmartset: temporary failure")
+	// ErrProtocol means the portal answered in an unexpected way, usually because the (undocumented) API changed
+	ErrProtocol = errors.New("wolfsmartset: unexpected response")
+)
+
+// IsTransient tells whether a request that failed with err is worth retrying
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTransient)
+}
+
+// StatusError is returned when the portal answers with an unexpected HTTP status
+type StatusError struct {
+	Op         string
+	StatusCode int
+	Status     string
+	Body       string
+	// Err is the sentinel classifying the failure
+	Err error
+}
+
+func newStatusError(op string, res *http.Response, body []byte) *StatusError {
+	e := &StatusError{Op: op, StatusCode: res.StatusCode, Status: res.Status, Body: string(body)}
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusGone:
+		e.Err = ErrProtocol
+	default:
+		e.Err = ErrTransient
+	}
+	return e
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %s", e.Op, e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// ProtocolError is returned when a response of the portal can't be understood,
+// usually this means the (undocumented) API changed
+type ProtocolError struct {
+	Op  string
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: unexpected response: %v", e.Op, e.Err)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProtocolError) Is(target error) bool {
+	return target == ErrProtocol
+}
+
+// TransportError is returned when the portal could not be reached or the response could not be read
+type TransportError struct {
+	Op  string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TransportError) Is(target error) bool {
+	return target == ErrTransient
+}
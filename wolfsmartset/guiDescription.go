@@ -0,0 +1,234 @@
+package wolfsmartset
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ParameterDescriptor struct {
+	ValueID                   int64      `json:"ValueId"`
+	SortID                    int        `json:"SortId"`
+	SubBundleID               int        `json:"SubBundleId"`
+	ParameterID               int64      `json:"ParameterId"`
+	IsReadOnly                bool       `json:"IsReadOnly"`
+	NoDataPoint               bool       `json:"NoDataPoint"`
+	IsExpertProtectable       bool       `json:"IsExpertProtectable"`
+	Name                      string     `json:"Name"`
+	Group                     string     `json:"Group"`
+	ProtGrp                   string     `json:"ProtGrp,omitempty"`
+	ControlType               int        `json:"ControlType"`
+	Value                     string     `json:"Value"`
+	ValueState                int        `json:"ValueState"`
+	HasDependentParameter     bool       `json:"HasDependentParameter"`
+	Unit                      string     `json:"Unit,omitempty"`
+	Decimals                  int        `json:"Decimals,omitempty"`
+	ListItems                 []ListItem `json:"ListItems,omitempty"`
+	MinValueCondition         string     `json:"MinValueCondition,omitempty"`
+	MaxValueCondition         string     `json:"MaxValueCondition,omitempty"`
+	MinValue                  float64    `json:"MinValue,omitempty"`
+	MaxValue                  float64    `json:"MaxValue,omitempty"`
+	StepWidth                 float64    `json:"StepWidth,omitempty"`
+	ChildParameterDescriptors []struct {
+		ValueID                   int64  `json:"ValueId"`
+		SortID                    int    `json:"SortId"`
+		SubBundleID               int    `json:"SubBundleId"`
+		ParameterID               int64  `json:"ParameterId"`
+		IsReadOnly                bool   `json:"IsReadOnly"`
+		NoDataPoint               bool   `json:"NoDataPoint"`
+		IsExpertProtectable       bool   `json:"IsExpertProtectable"`
+		Name                      string `json:"Name"`
+		ControlType               int    `json:"ControlType"`
+		ValueState                int    `json:"ValueState"`
+		HasDependentParameter     bool   `json:"HasDependentParameter"`
+		ChildParameterDescriptors []struct {
+			ValueID               int64   `json:"ValueId"`
+			SortID                int     `json:"SortId"`
+			SubBundleID           int     `json:"SubBundleId"`
+			ParameterID           int64   `json:"ParameterId"`
+			IsReadOnly            bool    `json:"IsReadOnly"`
+			NoDataPoint           bool    `json:"NoDataPoint"`
+			IsExpertProtectable   bool    `json:"IsExpertProtectable"`
+			Name                  string  `json:"Name"`
+			Group                 string  `json:"Group"`
+			ControlType           int     `json:"ControlType"`
+			ValueState            int     `json:"ValueState"`
+			HasDependentParameter bool    `json:"HasDependentParameter"`
+			Unit                  string  `json:"Unit"`
+			MinValueCondition     string  `json:"MinValueCondition"`
+			MaxValueCondition     string  `json:"MaxValueCondition"`
+			MinValue              float64 `json:"MinValue"`
+			MaxValue              float64 `json:"MaxValue"`
+			StepWidth             float64 `json:"StepWidth"`
+			Decimals              int     `json:"Decimals"`
+		} `json:"ChildParameterDescriptors"`
+	} `json:"ChildParameterDescriptors,omitempty"`
+}
+
+type ListItem struct {
+	Value               string `json:"Value"`
+	DisplayText         string `json:"DisplayText"`
+	IsSelectable        bool   `json:"IsSelectable"`
+	HighlightIfSelected bool   `json:"HighlightIfSelected"`
+}
+
+type GuiDescription struct {
+	MenuItems                  []MenuItem    `json:"MenuItems"`
+	DynFaultMessageDevices     []interface{} `json:"DynFaultMessageDevices"`
+	SystemHasWRSClassicDevices bool          `json:"SystemHasWRSClassicDevices"`
+}
+
+type MenuItem struct {
+	Name           string        `json:"Name"`
+	SortID         string        `json:"SortId"`
+	SubMenuEntries []interface{} `json:"SubMenuEntries"`
+	ParameterNode  bool          `json:"ParameterNode"`
+	ImageName      string        `json:"ImageName"`
+	TabViews       []TabView     `json:"TabViews"`
+}
+
+type TabView struct {
+	IsExpertView         bool                  `json:"IsExpertView"`
+	TabName              string                `json:"TabName"`
+	GuiID                int                   `json:"GuiId"`
+	BundleID             int                   `json:"BundleId"`
+	ParameterDescriptors []ParameterDescriptor `json:"ParameterDescriptors"`
+	ViewType             int                   `json:"ViewType"`
+	SvgSchemaDeviceID    int                   `json:"SvgSchemaDeviceId"`
+	GetValueLastAccess   time.Time             `json:"GetValueLastAccess"`
+	TabViewGroups        []struct {
+		GroupName       string `json:"GroupName"`
+		IsTitleEditable bool   `json:"IsTitleEditable"`
+	} `json:"TabViewGroups"`
+}
+
+// Parameters returns the parameter descriptors of all menu items and tabs
+func (d GuiDescription) Parameters() []ParameterDescriptor {
+	var params []ParameterDescriptor
+	for _, menuItem := range d.MenuItems {
+		for _, tabView := range menuItem.TabViews {
+			for _, parmeterDescriptor := range tabView.ParameterDescriptors {
+				params = append(params, parmeterDescriptor)
+			}
+		}
+	}
+	return params
+}
+
+// MenuParameter is a parameter descriptor together with the menu item and tab it is shown on
+type MenuParameter struct {
+	MenuItem     string
+	TabName      string
+	IsExpertView bool
+	ParameterDescriptor
+}
+
+// MenuParameters returns the parameter descriptors of all menu items and tabs along with their location in the GUI
+func (d GuiDescription) MenuParameters() []MenuParameter {
+	var params []MenuParameter
+	for _, menuItem := range d.MenuItems {
+		for _, tabView := range menuItem.TabViews {
+			for _, parameterDescriptor := range tabView.ParameterDescriptors {
+				params = append(params, MenuParameter{
+					MenuItem:            menuItem.Name,
+					TabName:             tabView.TabName,
+					IsExpertView:        tabView.IsExpertView,
+					ParameterDescriptor: parameterDescriptor,
+				})
+			}
+		}
+	}
+	return params
+}
+
+// IsWritable tells whether a parameter can be set via the portal
+func (param ParameterDescriptor) IsWritable() bool {
+	return !param.IsReadOnly && !param.NoDataPoint
+}
+
+// DisplayValue returns the display text of the list item matching a raw value,
+// the raw value itself for parameters without list items or if no item matches
+func (param ParameterDescriptor) DisplayValue(raw string) string {
+	for _, item := range param.ListItems {
+		if item.Value == raw {
+			return item.DisplayText
+		}
+	}
+	return raw
+}
+
+// NumericValue converts a raw value of a numeric parameter, the result is rounded to the decimals
+// of the parameter if these are known. List parameters and values that are no numbers yield false.
+func (param ParameterDescriptor) NumericValue(raw string) (float64, bool) {
+	if len(param.ListItems) > 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(raw), ",", ".", 1), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	if param.Decimals > 0 {
+		scale := math.Pow(10, float64(param.Decimals))
+		value = math.Round(value*scale) / scale
+	}
+	return value, true
+}
+
+// Validate checks a requested value against the constraints of the parameter
+// and returns it in the representation expected by the portal.
+// List parameters accept either the raw value or the display text of a list item.
+func (param ParameterDescriptor) Validate(requested string) (string, error) {
+	requested = strings.TrimSpace(requested)
+	if !param.IsWritable() {
+		return "", fmt.Errorf("parameter '%s' is read-only", param.Name)
+	}
+
+	if len(param.ListItems) > 0 {
+		for _, item := range param.ListItems {
+			if item.Value == requested || strings.EqualFold(item.DisplayText, requested) {
+				if !item.IsSelectable {
+					return "", fmt.Errorf("'%s' is not selectable for parameter '%s'", requested, param.Name)
+				}
+				return item.Value, nil
+			}
+		}
+		return "", fmt.Errorf("'%s' is not a valid option for parameter '%s'", requested, param.Name)
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(requested, ",", ".", 1), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", fmt.Errorf("'%s' is not a number, parameter '%s'", requested, param.Name)
+	}
+	if param.MaxValue > param.MinValue {
+		if value < param.MinValue || value > param.MaxValue {
+			return "", fmt.Errorf("%v is out of range [%v..%v] for parameter '%s'", value, param.MinValue, param.MaxValue, param.Name)
+		}
+	}
+	if param.StepWidth > 0 {
+		steps := (value - param.MinValue) / param.StepWidth
+		if math.Abs(steps-math.Round(steps)) > 1e-6 {
+			return "", fmt.Errorf("%v does not match step width %v for parameter '%s'", value, param.StepWidth, param.Name)
+		}
+	}
+	precision := -1 //shortest representation unless the portal defines decimals
+	if param.Decimals > 0 {
+		precision = param.Decimals
+	}
+	return strconv.FormatFloat(value, 'f', precision, 64), nil
+}
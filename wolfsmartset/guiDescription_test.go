@@ -0,0 +1,70 @@
+package wolfsmartset
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	setpoint := ParameterDescriptor{Name: "Raumsolltemperatur", MinValue: 5, MaxValue: 30, StepWidth: 0.5, Decimals: 1}
+	unlimited := ParameterDescriptor{Name: "Offset"}
+	mode := ParameterDescriptor{Name: "Betriebsart", ListItems: []ListItem{
+		{Value: "0", DisplayText: "Automatikbetrieb", IsSelectable: true},
+		{Value: "2", DisplayText: "Sparbetrieb", IsSelectable: true},
+		{Value: "3", DisplayText: "Standby"},
+	}}
+	readOnly := ParameterDescriptor{Name: "Kesseltemperatur", IsReadOnly: true}
+	noDataPoint := ParameterDescriptor{Name: "Info", NoDataPoint: true}
+
+	tests := []struct {
+		name      string
+		param     ParameterDescriptor
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"number", setpoint, "21.5", "21.5", false},
+		{"decimal comma", setpoint, "21,5", "21.5", false},
+		{"padded to decimals", setpoint, " 22 ", "22.0", false},
+		{"min", setpoint, "5", "5.0", false},
+		{"max", setpoint, "30", "30.0", false},
+		{"below min", setpoint, "4.5", "", true},
+		{"above max", setpoint, "30.5", "", true},
+		{"off step", setpoint, "21.3", "", true},
+		{"not a number", setpoint, "warm", "", true},
+		{"empty", setpoint, "", "", true},
+		{"NaN within limits", setpoint, "NaN", "", true},
+		{"NaN", unlimited, "nan", "", true},
+		{"Inf", unlimited, "Inf", "", true},
+		{"negative Inf", unlimited, "-Inf", "", true},
+		{"unlimited", unlimited, "1e3", "1000", false},
+		{"option value", mode, "2", "2", false},
+		{"option text", mode, "sparbetrieb", "2", false},
+		{"option not selectable", mode, "Standby", "", true},
+		{"unknown option", mode, "9", "", true},
+		{"read-only", readOnly, "50", "", true},
+		{"no data point", noDataPoint, "1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.param.Validate(tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate(%q) error = %v, wantErr %v", tt.requested, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Validate(%q) = %q, want %q", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package simulator
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+)
+
+// Fixtures are the systems served by the simulator, in the format of the portal
+type Fixtures struct {
+	Systems wolfsmartset.SystemList
+	// GuiDescriptions by system id
+	GuiDescriptions map[int]wolfsmartset.GuiDescription
+	// Values by system id, optional. Values not given start with the value in the GUI description.
+	Values map[int][]wolfsmartset.ParameterValue
+}
+
+// LoadFixtures reads fixtures from a directory with the files
+//
+//	systems.json          the answer to GetSystemList
+//	gui_<system id>.json  the answer to GetGuiDescriptionForGateway for each system
+//	values_<system id>.json (optional) the Values of a GetParameterValues answer
+func LoadFixtures(dir string) (*Fixtures, error) {
+	fixtures := &Fixtures{
+		GuiDescriptions: map[int]wolfsmartset.GuiDescription{},
+		Values:          map[int][]wolfsmartset.ParameterValue{},
+	}
+	if err := readFixture(filepath.Join(dir, "systems.json"), &fixtures.Systems); err != nil {
+		return nil, err
+	}
+	for _, system := range fixtures.Systems {
+		var guiDescription wolfsmartset.GuiDescription
+		if err := readFixture(filepath.Join(dir, fmt.Sprintf("gui_%d.json", system.ID)), &guiDescription); err != nil {
+			return nil, err
+		}
+		fixtures.GuiDescriptions[system.ID] = guiDescription
+
+		var values []wolfsmartset.ParameterValue
+		err := readFixture(filepath.Join(dir, fmt.Sprintf("values_%d.json", system.ID)), &values)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		fixtures.Values[system.ID] = values
+	}
+	return fixtures, nil
+}
+
+func readFixture(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// DefaultFixtures returns a system with a boiler, a heating circuit and domestic hot water
+func DefaultFixtures() *Fixtures {
+	system := wolfsmartset.System{
+		ID:                     4711,
+		GatewayID:              1234,
+		AccessLevel:            1,
+		GatewayUsername:        "simulator",
+		Name:                   "Simulated",
+		GatewaySoftwareVersion: "3.10.2",
+	}
+	onOff := []wolfsmartset.ListItem{{Value: "0", DisplayText: "Aus"}, {Value: "1", DisplayText: "An"}}
+	modes := []wolfsmartset.ListItem{
+		{Value: "0", DisplayText: "Automatikbetrieb", IsSelectable: true},
+		{Value: "1", DisplayText: "Heizbetrieb", IsSelectable: true},
+		{Value: "2", DisplayText: "Sparbetrieb", IsSelectable: true},
+		{Value: "3", DisplayText: "Standby", IsSelectable: true},
+	}
+
+	guiDescription := wolfsmartset.GuiDescription{MenuItems: []wolfsmartset.MenuItem{
+		{Name: "Heizgerät", TabViews: []wolfsmartset.TabView{
+			{TabName: "Übersicht", GuiID: 1, BundleID: 1000, ParameterDescriptors: []wolfsmartset.ParameterDescriptor{
+				sensor(1001, "Kesseltemperatur", "°C", 1, 0, 90, "48.5"),
+				sensor(1002, "Außentemperatur", "°C", 1, -20, 40, "7.3"),
+				sensor(1003, "Anlagendruck", "bar", 2, 0, 3, "1.85"),
+				sensor(1004, "Modulationsgrad", "%", 0, 0, 100, "35"),
+				{ValueID: 1005, ParameterID: 2005, Name: "Brennerstatus", IsReadOnly: true, ListItems: onOff, Value: "1"},
+			}},
+		}},
+		{Name: "Heizkreis", TabViews: []wolfsmartset.TabView{
+			{TabName: "Übersicht", GuiID: 2, BundleID: 1000, ParameterDescriptors: []wolfsmartset.ParameterDescriptor{
+				{ValueID: 1011, ParameterID: 2011, Name: "Betriebsart", ListItems: modes, Value: "0"},
+				setpoint(1012, "Raumsolltemperatur", "°C", 1, 5, 30, 0.5, "21.0"),
+				sensor(1013, "Vorlauftemperatur", "°C", 1, 0, 90, "38.2"),
+			}},
+			{TabName: "Fachmann", IsExpertView: true, GuiID: 3, BundleID: 1000, ParameterDescriptors: []wolfsmartset.ParameterDescriptor{
+				setpoint(1021, "Heizkurve", "", 1, 0.1, 3.5, 0.1, "1.2"),
+			}},
+		}},
+		{Name: "Warmwasser", TabViews: []wolfsmartset.TabView{
+			{TabName: "Übersicht", GuiID: 4, BundleID: 1000, ParameterDescriptors: []wolfsmartset.ParameterDescriptor{
+				sensor(1031, "Warmwassertemperatur", "°C", 1, 0, 90, "52.0"),
+				setpoint(1032, "Warmwassersolltemperatur", "°C", 0, 30, 65, 1, "50"),
+			}},
+		}},
+	}}
+
+	return &Fixtures{
+		Systems:         wolfsmartset.SystemList{system},
+		GuiDescriptions: map[int]wolfsmartset.GuiDescription{system.ID: guiDescription},
+		Values:          map[int][]wolfsmartset.ParameterValue{},
+	}
+}
+
+func sensor(valueID int64, name string, unit string, decimals int, min float64, max float64, value string) wolfsmartset.ParameterDescriptor {
+	return wolfsmartset.ParameterDescriptor{ValueID: valueID, ParameterID: valueID + 1000, Name: name, IsReadOnly: true,
+		Unit: unit, Decimals: decimals, MinValue: min, MaxValue: max, Value: value}
+}
+
+func setpoint(valueID int64, name string, unit string, decimals int, min float64, max float64, step float64, value string) wolfsmartset.ParameterDescriptor {
+	return wolfsmartset.ParameterDescriptor{ValueID: valueID, ParameterID: valueID + 1000, Name: name,
+		Unit: unit, Decimals: decimals, MinValue: min, MaxValue: max, StepWidth: step, Value: value}
+}
@@ -0,0 +1,371 @@
+// Package simulator serves the API of the Wolf Smartset portal from fixtures, for development without
+// an account and for tests of code using the wolfsmartset package.
+package simulator
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+)
+
+// Options control the behaviour of the simulated portal
+type Options struct {
+	// Username and Password are the accepted credentials, any are accepted if Username is empty
+	Username string
+	Password string
+	// TokenLifetime is the lifetime of access tokens, requests with expired tokens fail with 401. Defaults to one hour.
+	TokenLifetime time.Duration
+	// Drift is the maximum change of read-only numeric values per request for values
+	Drift float64
+	// ErrorRate is the share of requests (0..1) answered with 500 Internal Server Error
+	ErrorRate float64
+	// Latency delays every response
+	Latency time.Duration
+	// Seed of the random numbers used for drift and errors, 0 uses the current time
+	Seed int64
+}
+
+// Portal is a http.Handler simulating the portal. It serves the API below /portal/ (and /),
+// so a client can use BaseURL http://<address>/portal/ as with the real portal.
+type Portal struct {
+	mu       sync.Mutex
+	fixtures *Fixtures
+	opts     Options
+	rand     *rand.Rand
+
+	// tokens are the expiry times of the issued access tokens
+	tokens        map[string]time.Time
+	refreshTokens map[string]bool
+	sessions      map[int]bool
+	lastID        int
+	// values by system id and value id
+	values map[int]map[int64]wolfsmartset.ParameterValue
+	params map[int]map[int64]wolfsmartset.ParameterDescriptor
+	// failures are status codes to answer the next requests of an API call with, see FailNext
+	failures map[string][]int
+}
+
+// New creates a simulated portal serving fixtures
+func New(fixtures *Fixtures, opts Options) *Portal {
+	if opts.TokenLifetime <= 0 {
+		opts.TokenLifetime = time.Hour
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	p := &Portal{
+		fixtures:      fixtures,
+		opts:          opts,
+		rand:          rand.New(rand.NewSource(opts.Seed)),
+		tokens:        map[string]time.Time{},
+		refreshTokens: map[string]bool{},
+		sessions:      map[int]bool{},
+		values:        map[int]map[int64]wolfsmartset.ParameterValue{},
+		params:        map[int]map[int64]wolfsmartset.ParameterDescriptor{},
+		failures:      map[string][]int{},
+	}
+	for _, system := range fixtures.Systems {
+		p.values[system.ID] = map[int64]wolfsmartset.ParameterValue{}
+		p.params[system.ID] = map[int64]wolfsmartset.ParameterDescriptor{}
+		for _, param := range fixtures.GuiDescriptions[system.ID].Parameters() {
+			p.params[system.ID][param.ValueID] = param
+			p.values[system.ID][param.ValueID] = wolfsmartset.ParameterValue{ValueID: param.ValueID, Value: param.Value, State: param.ValueState}
+		}
+		for _, value := range fixtures.Values[system.ID] {
+			p.values[system.ID][value.ValueID] = value
+		}
+	}
+	return p
+}
+
+// NewServer starts a simulated portal on a local port, for tests.
+// Point the client to it with client.SetBaseURL(server.URL + "/portal/") and close the server when done.
+func NewServer(fixtures *Fixtures, opts Options) (*Portal, *httptest.Server) {
+	p := New(fixtures, opts)
+	return p, httptest.NewServer(p)
+}
+
+// FailNext answers the next requests of an API call, e.g. "GetParameterValues" or "token2", with the given status codes
+func (p *Portal) FailNext(call string, statusCodes ...int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures[call] = append(p.failures[call], statusCodes...)
+}
+
+// ExpireTokens lets all issued access tokens expire, refresh tokens stay valid
+func (p *Portal) ExpireTokens() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for token := range p.tokens {
+		p.tokens[token] = time.Time{}
+	}
+}
+
+// SetLatency changes the delay of the responses
+func (p *Portal) SetLatency(latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opts.Latency = latency
+}
+
+// Value returns the current raw value of a parameter, e.g. to check a write
+func (p *Portal) Value(systemID int, valueID int64) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	value, ok := p.values[systemID][valueID]
+	return value.Value, ok
+}
+
+func (p *Portal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/portal"), "/")
+	call := path[strings.LastIndex(path, "/")+1:]
+
+	p.mu.Lock()
+	latency := p.opts.Latency
+	status := 0
+	if failures := p.failures[call]; len(failures) > 0 {
+		status, p.failures[call] = failures[0], failures[1:]
+	} else if p.opts.ErrorRate > 0 && p.rand.Float64() < p.opts.ErrorRate {
+		status = http.StatusInternalServerError
+	}
+	p.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		http.Error(w, "simulated failure", status)
+		return
+	}
+
+	if path == "connect/token2" {
+		p.token(w, r)
+		return
+	}
+	if !p.authorized(r) {
+		http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	switch path {
+	case "api/portal/CreateSession":
+		p.createSession(w, r)
+	case "api/portal/UpdateSession":
+		p.updateSession(w, r)
+	case "api/portal/GetSystemList":
+		writeJSON(w, p.fixtures.Systems)
+	case "api/portal/GetGuiDescriptionForGateway":
+		p.guiDescription(w, r)
+	case "api/portal/GetParameterValues":
+		p.parameterValues(w, r)
+	case "api/portal/WriteParameterValues":
+		p.writeParameterValues(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Portal) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch r.PostForm.Get("grant_type") {
+	case "password":
+		if len(p.opts.Username) > 0 && (r.PostForm.Get("username") != p.opts.Username || r.PostForm.Get("password") != p.opts.Password) {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		if !p.refreshTokens[refreshToken] {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		delete(p.refreshTokens, refreshToken)
+	default:
+		http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+		return
+	}
+	p.lastID++
+	token := wolfsmartset.AuthToken{
+		AccessToken:     fmt.Sprintf("sim-access-%d", p.lastID),
+		ExpiresIn:       int(p.opts.TokenLifetime / time.Second),
+		TokenType:       "Bearer",
+		RefreshToken:    fmt.Sprintf("sim-refresh-%d", p.lastID),
+		Scope:           "all",
+		CultureInfoCode: "de-DE",
+	}
+	p.tokens[token.AccessToken] = time.Now().Add(p.opts.TokenLifetime)
+	p.refreshTokens[token.RefreshToken] = true
+	writeJSON(w, token)
+}
+
+func (p *Portal) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	expires, ok := p.tokens[token]
+	return ok && time.Now().Before(expires)
+}
+
+func (p *Portal) createSession(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastID++
+	p.sessions[p.lastID] = true
+	fmt.Fprint(w, p.lastID)
+}
+
+func (p *Portal) updateSession(w http.ResponseWriter, r *http.Request) {
+	var req wolfsmartset.SessionStr
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !p.validSession(req.SessionID) {
+		http.Error(w, "unknown session", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, true)
+}
+
+func (p *Portal) validSession(sessionID int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[sessionID]
+}
+
+func (p *Portal) guiDescription(w http.ResponseWriter, r *http.Request) {
+	systemID, _ := strconv.Atoi(r.URL.Query().Get("SystemId"))
+	gatewayID, _ := strconv.Atoi(r.URL.Query().Get("GatewayId"))
+	if !p.knownSystem(systemID, gatewayID) {
+		http.Error(w, "unknown system", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, p.fixtures.GuiDescriptions[systemID])
+}
+
+func (p *Portal) knownSystem(systemID int, gatewayID int) bool {
+	for _, system := range p.fixtures.Systems {
+		if system.ID == systemID && system.GatewayID == gatewayID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Portal) parameterValues(w http.ResponseWriter, r *http.Request) {
+	var req wolfsmartset.ParameterValuesRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !p.validSession(req.SessionID) || !p.knownSystem(req.SystemID, req.GatewayID) {
+		http.Error(w, "unknown session or system", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	response := wolfsmartset.ParameterValuesResponse{LastAccess: time.Now().UTC().Format(time.RFC3339Nano)}
+	for _, valueID := range req.ValueIDList {
+		value, ok := p.values[req.SystemID][valueID]
+		if !ok {
+			continue
+		}
+		value = p.drift(p.params[req.SystemID][valueID], value)
+		p.values[req.SystemID][valueID] = value
+		response.Values = append(response.Values, value)
+	}
+	writeJSON(w, response)
+}
+
+// drift changes read-only numeric values randomly by up to Options.Drift, within the limits of the parameter
+func (p *Portal) drift(param wolfsmartset.ParameterDescriptor, value wolfsmartset.ParameterValue) wolfsmartset.ParameterValue {
+	numeric, ok := param.NumericValue(value.Value)
+	if p.opts.Drift == 0 || !ok || !param.IsReadOnly {
+		return value
+	}
+	numeric += (p.rand.Float64()*2 - 1) * p.opts.Drift
+	if param.MaxValue > param.MinValue {
+		numeric = math.Max(param.MinValue, math.Min(param.MaxValue, numeric))
+	}
+	value.Value = strconv.FormatFloat(numeric, 'f', param.Decimals, 64)
+	return value
+}
+
+func (p *Portal) writeParameterValues(w http.ResponseWriter, r *http.Request) {
+	var req wolfsmartset.WriteParameterValuesRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !p.validSession(req.SessionID) || !p.knownSystem(req.SystemID, req.GatewayID) {
+		http.Error(w, "unknown session or system", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, write := range req.WriteParameterValues {
+		param, ok := p.params[req.SystemID][write.ValueID]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown value id %d", write.ValueID), http.StatusBadRequest)
+			return
+		}
+		if _, err := param.Validate(write.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, write := range req.WriteParameterValues {
+		value := p.values[req.SystemID][write.ValueID]
+		value.Value = write.Value
+		p.values[req.SystemID][write.ValueID] = value
+	}
+	writeJSON(w, true)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
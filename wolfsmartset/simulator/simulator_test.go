@@ -0,0 +1,231 @@
+package simulator_test
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset"
+	"github.com/kgbvax/wolfmqttbridge/wolfsmartset/simulator"
+)
+
+// connect logs in to a simulated portal and opens a session
+func connect(t *testing.T, fixtures *simulator.Fixtures, opts simulator.Options) (*simulator.Portal, func(), *wolfsmartset.Client, string, int) {
+	t.Helper()
+	portal, server := simulator.NewServer(fixtures, opts)
+	client := wolfsmartset.NewClient(server.Client())
+	if err := client.SetBaseURL(server.URL + "/portal/"); err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	token, err := client.GetAuthToken(ctx, "user", "secret")
+	if err != nil {
+		server.Close()
+		t.Fatal("login failed: ", err)
+	}
+	sessId, err := client.CreateSession(ctx, token.AccessToken)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return portal, server.Close, client, token.AccessToken, sessId
+}
+
+func TestCredentials(t *testing.T) {
+	_, server := simulator.NewServer(simulator.DefaultFixtures(), simulator.Options{Username: "user", Password: "secret"})
+	defer server.Close()
+	client := wolfsmartset.NewClient(server.Client())
+	if err := client.SetBaseURL(server.URL + "/portal/"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := client.GetAuthToken(ctx, "user", "wrong"); !errors.Is(err, wolfsmartset.ErrBadCredentials) {
+		t.Errorf("wrong password: error = %v, want ErrBadCredentials", err)
+	}
+	token, err := client.GetAuthToken(ctx, "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetSystemList(ctx, "forged"); !wolfsmartset.IsTransient(err) {
+		t.Errorf("unknown token: error = %v, want 401", err)
+	}
+	if _, err := client.RefreshAuthToken(ctx, token.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RefreshAuthToken(ctx, token.RefreshToken); !errors.Is(err, wolfsmartset.ErrBadCredentials) {
+		t.Errorf("reused refresh token: error = %v, want ErrBadCredentials", err)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	portal, stop, client, token, _ := connect(t, simulator.DefaultFixtures(), simulator.Options{})
+	defer stop()
+	ctx := context.Background()
+
+	portal.FailNext("GetSystemList", http.StatusServiceUnavailable, http.StatusNotFound)
+	var statusErr *wolfsmartset.StatusError
+	for _, want := range []int{http.StatusServiceUnavailable, http.StatusNotFound} {
+		_, err := client.GetSystemList(ctx, token)
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != want {
+			t.Errorf("error = %v, want status %d", err, want)
+		}
+	}
+	if _, err := client.GetSystemList(ctx, token); err != nil {
+		t.Errorf("request after the simulated failures: %v", err)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	fixtures := simulator.DefaultFixtures()
+	system := fixtures.Systems[0]
+	_, stop, client, token, sessId := connect(t, fixtures, simulator.Options{Drift: 5, Seed: 1})
+	defer stop()
+	params := map[int64]wolfsmartset.ParameterDescriptor{}
+	var valIdList []int64
+	for _, param := range fixtures.GuiDescriptions[system.ID].Parameters() {
+		params[param.ValueID] = param
+		valIdList = append(valIdList, param.ValueID)
+	}
+
+	drifted := false
+	for i := 0; i < 20; i++ {
+		values, err := client.GetParameterValues(context.Background(), token, sessId, valIdList, "", system)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range values.Values {
+			param := params[value.ValueID]
+			if !param.IsReadOnly || len(param.ListItems) > 0 {
+				if value.Value != param.Value {
+					t.Fatalf("%s changed from %s to %s, only read-only numbers drift", param.Name, param.Value, value.Value)
+				}
+				continue
+			}
+			numeric, ok := param.NumericValue(value.Value)
+			if !ok || numeric < param.MinValue || numeric > param.MaxValue {
+				t.Fatalf("%s = %s, want a number in [%v..%v]", param.Name, value.Value, param.MinValue, param.MaxValue)
+			}
+			drifted = drifted || value.Value != param.Value
+		}
+	}
+	if !drifted {
+		t.Error("no value drifted")
+	}
+}
+
+func TestWriteIsValidated(t *testing.T) {
+	fixtures := simulator.DefaultFixtures()
+	system := fixtures.Systems[0]
+	portal, stop, client, token, sessId := connect(t, fixtures, simulator.Options{})
+	defer stop()
+	ctx := context.Background()
+
+	tests := []struct {
+		valueID int64
+		value   string
+		wantErr bool
+	}{
+		{1012, "22.5", false},
+		{1011, "2", false},
+		{1012, "22.3", true}, // off step
+		{1012, "99", true},   // above max
+		{1001, "50.0", true}, // read-only
+		{9999, "1", true},    // unknown
+	}
+	for _, tt := range tests {
+		before, _ := portal.Value(system.ID, tt.valueID)
+		err := client.WriteParameterValues(ctx, token, sessId, []wolfsmartset.WriteParameterValue{{ValueID: tt.valueID, Value: tt.value}}, system)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("write %d = %s: error = %v, wantErr %v", tt.valueID, tt.value, err, tt.wantErr)
+		}
+		want := tt.value
+		if tt.wantErr {
+			want = before
+		}
+		if got, _ := portal.Value(system.ID, tt.valueID); got != want {
+			t.Errorf("value of %d after write = %q, want %q", tt.valueID, got, want)
+		}
+	}
+}
+
+func TestUnknownSession(t *testing.T) {
+	fixtures := simulator.DefaultFixtures()
+	_, stop, client, token, sessId := connect(t, fixtures, simulator.Options{})
+	defer stop()
+
+	_, err := client.GetParameterValues(context.Background(), token, sessId+100, []int64{1001}, "", fixtures.Systems[0])
+	var statusErr *wolfsmartset.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("error = %v, want status 400", err)
+	}
+	if err := client.RefreshSession(context.Background(), token, sessId); err != nil {
+		t.Errorf("refreshing the session failed: %v", err)
+	}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"systems.json": `[{"Id": 42, "GatewayId": 7, "Name": "Ferienhaus"}]`,
+		"gui_42.json": `{"MenuItems": [{"Name": "Heizgerät", "TabViews": [{"TabName": "Übersicht", "ParameterDescriptors": [
+			{"ValueId": 1, "Name": "Kesseltemperatur", "IsReadOnly": true, "Value": "40.0"},
+			{"ValueId": 2, "Name": "Außentemperatur", "IsReadOnly": true, "Value": "5.0"}]}]}]}`,
+		"values_42.json": `[{"ValueId": 2, "Value": "-3.5", "State": 1}]`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fixtures, err := simulator.LoadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures.Systems) != 1 || fixtures.Systems[0].Name != "Ferienhaus" {
+		t.Fatalf("systems = %+v", fixtures.Systems)
+	}
+	portal := simulator.New(fixtures, simulator.Options{})
+	for valueID, want := range map[int64]string{1: "40.0", 2: "-3.5"} {
+		if got, ok := portal.Value(42, valueID); !ok || got != want {
+			t.Errorf("value of %d = %q, want %q", valueID, got, want)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, "values_42.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulator.LoadFixtures(dir); err != nil {
+		t.Errorf("values are optional, got %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "gui_42.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulator.LoadFixtures(dir); err == nil {
+		t.Error("missing GUI description accepted")
+	}
+}
@@ -0,0 +1,89 @@
+package wolfsmartset
+
+/* This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+type SessionStr struct {
+	SessionID int `json:"SessionId"`
+}
+
+type SystemStateRequest struct {
+	SessionID  int `json:"SessionId"`
+	SystemList []struct {
+		SystemID  int `json:"SystemId"`
+		GatewayID int `json:"GatewayId"`
+	} `json:"SystemList"`
+}
+
+type ParameterValuesRequest struct {
+	BundleID     int     `json:"BundleId"`
+	IsSubBundle  bool    `json:"IsSubBundle"`
+	ValueIDList  []int64 `json:"ValueIdList"`
+	GatewayID    int     `json:"GatewayId"`
+	SystemID     int     `json:"SystemId"`
+	LastAccess   string  `json:"LastAccess"`
+	GuiIDChanged bool    `json:"GuiIdChanged"`
+	SessionID    int     `json:"SessionId"`
+}
+
+type WriteParameterValue struct {
+	ValueID int64  `json:"ValueId"`
+	Value   string `json:"Value"`
+}
+
+type WriteParameterValuesRequest struct {
+	WriteParameterValues []WriteParameterValue `json:"WriteParameterValues"`
+	SystemID             int                   `json:"SystemId"`
+	GatewayID            int                   `json:"GatewayId"`
+	BundleID             int                   `json:"BundleId"`
+	IsSubBundle          bool                  `json:"IsSubBundle"`
+	GuiIDChanged         bool                  `json:"GuiIdChanged"`
+	SessionID            int                   `json:"SessionId"`
+}
+
+type ParameterValue struct {
+	ValueID int64  `json:"ValueId"`
+	Value   string `json:"Value"`
+	State   int    `json:"State"`
+}
+
+type ParameterValuesResponse struct {
+	LastAccess      string           `json:"LastAccess"`
+	Values          []ParameterValue `json:"Values"`
+	IsNewJobCreated bool             `json:"IsNewJobCreated"`
+}
+
+type AuthToken struct {
+	AccessToken                 string `json:"access_token"`
+	ExpiresIn                   int    `json:"expires_in"`
+	TokenType                   string `json:"token_type"`
+	RefreshToken                string `json:"refresh_token"`
+	Scope                       string `json:"scope"`
+	CultureInfoCode             string `json:"CultureInfoCode"`
+	IsPasswordReset             bool   `json:"IsPasswordReset"`
+	IsProfessional              bool   `json:"IsProfessional"`
+	IsProfessionalPasswordReset bool   `json:"IsProfessionalPasswordReset"`
+}
+
+type System struct {
+	ID                     int           `json:"Id"`
+	GatewayID              int           `json:"GatewayId"`
+	IsForeignSystem        bool          `json:"IsForeignSystem"`
+	AccessLevel            int           `json:"AccessLevel"`
+	GatewayUsername        string        `json:"GatewayUsername"`
+	Name                   string        `json:"Name"`
+	SystemShares           []interface{} `json:"SystemShares"`
+	GatewaySoftwareVersion string        `json:"GatewaySoftwareVersion"`
+}
+type SystemList []System